@@ -1,15 +1,21 @@
 package auth
 
 import (
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/logging"
 	"errors"
+	"log/slog"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	jwt "github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type JwtWrapper struct {
@@ -18,21 +24,34 @@ type JwtWrapper struct {
 	ExpirationTime int64
 }
 
+// NewJwtWrapper builds a JwtWrapper from the auth settings.
+func NewJwtWrapper(cfg config.Auth) JwtWrapper {
+	return JwtWrapper{
+		SecretKey:      cfg.JwtSecret,
+		Issuer:         cfg.JwtIssuer,
+		ExpirationTime: cfg.TokenExpiryHours,
+	}
+}
+
 type JwtClaim struct {
 	UserId   primitive.ObjectID
 	Email    string
 	UserType string
+	// PasswordChangeRequired limits the token to the routes that let the user change their password.
+	PasswordChangeRequired bool `json:",omitempty"`
 	jwt.StandardClaims
 }
 
 
-// GenrateToken generates a JWT token based on user data and signs it with the secret key
-func (j *JwtWrapper) GenrateToken(id primitive.ObjectID, email, userType string) (token string, err error) {
+// GenrateToken generates a JWT token based on user data and signs it with the secret key.
+// Tokens for users who must change their password are marked as such.
+func (j *JwtWrapper) GenrateToken(id primitive.ObjectID, email, userType string, passwordChangeRequired bool) (token string, err error) {
 	// Define claims struct to hold user-specific data and standard JWT claims
 	claims := &JwtClaim{
 			UserId:   id,         // Set the user's unique ID
 			UserType: userType,   // Set the user's type (e.g., admin, regular user)
 			Email:    email,      // Set the user's email
+			PasswordChangeRequired: passwordChangeRequired,
 			StandardClaims: jwt.StandardClaims{
 					ExpiresAt: time.Now().Add(time.Hour * time.Duration(j.ExpirationTime)).Unix(), // Set expiration time (in hours, based on ExpirationTime)
 					Issuer:    j.Issuer, // Set the issuer of the token (from JwtWrapper)
@@ -90,7 +109,10 @@ func (j *JwtWrapper) ValidateToken(signedToken string) (claims *JwtClaim, err er
 }
 
 
-func Auth() gin.HandlerFunc {
+func Auth(cfg config.Auth) gin.HandlerFunc {
+	// Create a JWT wrapper instance with your secret and issuer
+	jwtWrapper := NewJwtWrapper(cfg)
+
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		token := c.Request.Header.Get("Authorization")
@@ -113,12 +135,6 @@ func Auth() gin.HandlerFunc {
 		// Trim spaces and extract the actual token
 		clientToken := strings.TrimSpace(extractedToken[1])
 
-		// Create a JWT wrapper instance with your secret and issuer
-		jwtWrapper := JwtWrapper{
-			SecretKey: os.Getenv("JwtSecrets"),
-			Issuer:    os.Getenv("JwtIssuer"),
-		}
-
 		// Validate the token using your JWT wrapper
 		claims, err := jwtWrapper.ValidateToken(clientToken)
 		if err != nil {
@@ -128,12 +144,52 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
-		// Set claims data into context for further processing
-		c.Set("user_id", claims.UserId)
-		c.Set("email", claims.Email)
-		c.Set("user_type", claims.UserType)
+		// Load the user the token was issued to; the claims only identify it
+		principal, err := principals.load(c.Request.Context(), claims.UserId, cfg.PrincipalCacheTTL)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token"})
+			return
+		case database.IsTimeout(err):
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": true, "message": err.Error()})
+			return
+		case err != nil:
+			slog.ErrorContext(c.Request.Context(), "loading principal", "err", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": true, "message": err.Error()})
+			return
+		}
+		// a token issued for a password change stays restricted after the change
+		principal.PasswordChangeRequired = principal.PasswordChangeRequired || claims.PasswordChangeRequired
+
+		// Set the principal into context for further processing
+		c.Set(principalKey, principal)
+		logging.Annotate(c, slog.String("user_id", principal.ID.Hex()))
 
 		// Call the next handler in the chain
 		c.Next()
 	}
 }
+
+// RequireRoles rejects requests whose principal has a user type outside roles.
+// It must run after Auth.
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, MustPrincipal(c).UserType) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": true, "message": constant.NotAuthorizedUserError})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePasswordChanged rejects tokens issued to users who must change their
+// password first. It must run after Auth.
+func RequirePasswordChanged() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if MustPrincipal(c).PasswordChangeRequired {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": true, "message": constant.PasswordChangeRequiredError})
+			return
+		}
+		c.Next()
+	}
+}
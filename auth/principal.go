@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// principalKey is the gin context key Auth stores the Principal under.
+const principalKey = "principal"
+
+// maxCachedPrincipals bounds the principal cache; past it expired entries are
+// swept, and if that isn't enough the cache starts over.
+const maxCachedPrincipals = 10000
+
+// Principal is the user a request is made by. Auth loads it by the user ID in
+// the token, so it reflects the account as stored now rather than as it was
+// when the token was issued: an email change doesn't invalidate tokens, and a
+// changed role takes effect without logging in again.
+type Principal struct {
+	ID       primitive.ObjectID
+	Email    string
+	Name     string
+	UserType string
+	// PasswordChangeRequired is set when the account or the token is limited
+	// to changing the password.
+	PasswordChangeRequired bool
+}
+
+// IsAdmin reports whether the principal is an admin.
+func (p Principal) IsAdmin() bool {
+	return p.UserType == constant.AdminUser
+}
+
+// PrincipalFrom returns the Principal Auth stored in c. ok is false on routes
+// that don't require authentication.
+func PrincipalFrom(c *gin.Context) (p Principal, ok bool) {
+	p, ok = c.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// MustPrincipal is PrincipalFrom for handlers behind Auth. It panics if Auth
+// didn't run, which is a routing bug.
+func MustPrincipal(c *gin.Context) Principal {
+	return c.MustGet(principalKey).(Principal)
+}
+
+type cachedPrincipal struct {
+	principal Principal
+	expires   time.Time
+}
+
+// principalCache keeps recently loaded principals so that authenticated
+// requests don't each need a user lookup.
+type principalCache struct {
+	mu      sync.Mutex
+	entries map[primitive.ObjectID]cachedPrincipal
+}
+
+var principals = &principalCache{entries: map[primitive.ObjectID]cachedPrincipal{}}
+
+// load returns the principal for id, from the cache if it was loaded less
+// than ttl ago. It returns mongo.ErrNoDocuments if the user no longer exists.
+func (pc *principalCache) load(ctx context.Context, id primitive.ObjectID, ttl time.Duration) (Principal, error) {
+	now := time.Now()
+	pc.mu.Lock()
+	entry, ok := pc.entries[id]
+	pc.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.principal, nil
+	}
+
+	user, err := database.Mgr.GetSingleUserByUserId(ctx, id, constant.UserCollection)
+	if err != nil {
+		return Principal{}, err
+	}
+	p := Principal{
+		ID:                     user.Id,
+		Email:                  user.Email,
+		Name:                   user.Name,
+		UserType:               user.UserType,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+	}
+	if ttl <= 0 {
+		return p, nil
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.entries) >= maxCachedPrincipals {
+		for k, e := range pc.entries {
+			if !now.Before(e.expires) {
+				delete(pc.entries, k)
+			}
+		}
+		if len(pc.entries) >= maxCachedPrincipals {
+			pc.entries = map[primitive.ObjectID]cachedPrincipal{}
+		}
+	}
+	pc.entries[id] = cachedPrincipal{principal: p, expires: now.Add(ttl)}
+	return p, nil
+}
+
+// Forget drops the cached principal for a user. Handlers that change a user's
+// email, role or password restriction call it so the next request sees the
+// change.
+func Forget(id primitive.ObjectID) {
+	principals.mu.Lock()
+	defer principals.mu.Unlock()
+	delete(principals.entries, id)
+}
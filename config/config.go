@@ -0,0 +1,713 @@
+// Package config loads the application settings into a typed struct.
+//
+// Values are resolved in this order, later sources winning:
+// built-in defaults, the YAML file named by CONFIG_FILE, .env, and the process environment.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// database backends accepted in Database.Driver
+const (
+	MongoDriver  = "mongo"
+	MemoryDriver = "memory"
+)
+
+// trace exporters accepted in Tracing.Exporter
+const (
+	NoTraceExporter     = "none"
+	OTLPTraceExporter   = "otlp"
+	StdoutTraceExporter = "stdout"
+)
+
+// password hashing algorithms accepted in Password.Algorithm
+const (
+	BcryptAlgorithm   = "bcrypt"
+	Argon2idAlgorithm = "argon2id"
+)
+
+// log output formats accepted in Log.Format
+const (
+	JSONLogFormat = "json"
+	TextLogFormat = "text"
+)
+
+// storage backends accepted in Storage.Driver
+const (
+	LocalStorage = "local"
+	S3Storage    = "s3"
+)
+
+// contextKey is the gin context key the request-scoped config is stored under.
+const contextKey = "config"
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	Email    Email    `yaml:"email"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+	CORS     CORS     `yaml:"cors"`
+	Password Password `yaml:"password"`
+	Storage  Storage  `yaml:"storage"`
+	Admin    Admin    `yaml:"admin"`
+}
+
+type Server struct {
+	Port string `yaml:"port"`
+	// LegacyPrefix is where the deprecated pre-v1 routes are served, e.g. /api/v1 for
+	// /api/v1/ecommerce/login. The versioned routes always live under /api/v1.
+	LegacyPrefix    string        `yaml:"legacy_prefix"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For is believed when working out the client IP for rate limits.
+	// Empty trusts none and uses the connection's remote address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type Database struct {
+	// Driver selects the backend: "mongo" or "memory".
+	Driver string `yaml:"driver"`
+	// URI is a full MongoDB connection string (mongodb:// or mongodb+srv://). When set it
+	// replaces Host; the explicit options below still override what the URI specifies.
+	URI  string `yaml:"uri"`
+	Host string `yaml:"host"`
+	Name string `yaml:"name"`
+
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	AuthSource string `yaml:"auth_source"`
+	ReplicaSet string `yaml:"replica_set"`
+
+	TLS            bool   `yaml:"tls"`
+	TLSCAFile      string `yaml:"tls_ca_file"`
+	TLSCertKeyFile string `yaml:"tls_cert_key_file"`
+
+	MinPoolSize            uint64        `yaml:"min_pool_size"`
+	MaxPoolSize            uint64        `yaml:"max_pool_size"`
+	MaxConnIdleTime        time.Duration `yaml:"max_conn_idle_time"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout"`
+
+	// ReadPreference is one of primary, primaryPreferred, secondary, secondaryPreferred or nearest.
+	ReadPreference string `yaml:"read_preference"`
+	// WriteConcern is "majority", a node count such as "1", or a tag set name.
+	WriteConcern        string `yaml:"write_concern"`
+	WriteConcernJournal bool   `yaml:"write_concern_journal"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// AutoMigrate applies pending schema migrations and indexes at startup.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// readPreferences are the read preference modes MongoDB accepts.
+var readPreferences = []string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"}
+
+type Auth struct {
+	JwtSecret string `yaml:"jwt_secret"`
+	JwtIssuer string `yaml:"jwt_issuer"`
+	// TokenExpiryHours is how long issued tokens stay valid.
+	TokenExpiryHours int64 `yaml:"token_expiry_hours"`
+	// PrincipalCacheTTL is how long the user a token belongs to is cached
+	// between requests. Zero loads it on every request.
+	PrincipalCacheTTL time.Duration `yaml:"principal_cache_ttl"`
+}
+
+type Email struct {
+	SendGridAPIKey string `yaml:"sendgrid_api_key"`
+	Sender         string `yaml:"sender"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is "json" for production or "text" for reading locally.
+	Format string `yaml:"format"`
+}
+
+type Tracing struct {
+	// Exporter is "none", "otlp" to send spans to a collector, or "stdout" to print them.
+	Exporter    string `yaml:"exporter"`
+	ServiceName string `yaml:"service_name"`
+	// Endpoint is the OTLP/HTTP collector address as host:port.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends spans over plain HTTP instead of HTTPS.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type CORS struct {
+	// AllowedOrigins lists the origins browsers may call the API from, such as
+	// https://shop.example.com. "https://*.example.com" admits any subdomain and
+	// "*" any origin. Empty disables CORS.
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	MaxAge           time.Duration `yaml:"max_age"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+}
+
+type Password struct {
+	// Algorithm hashes new passwords: "bcrypt" or "argon2id". Hashes made with
+	// the other algorithm or weaker parameters are upgraded at the next login.
+	Algorithm  string `yaml:"algorithm"`
+	BcryptCost int    `yaml:"bcrypt_cost"`
+	// Argon2 parameters; memory is in KiB.
+	Argon2Time      int `yaml:"argon2_time"`
+	Argon2MemoryKiB int `yaml:"argon2_memory_kib"`
+	Argon2Threads   int `yaml:"argon2_threads"`
+
+	MinLength int `yaml:"min_length"`
+	// BreachedListFile names a file of known-breached passwords, one per line,
+	// either in plain text or as SHA-1 hex in the Pwned Passwords "HASH:count" format.
+	BreachedListFile string `yaml:"breached_list_file"`
+}
+
+type Storage struct {
+	// Driver selects where uploaded files go: "local" or "s3".
+	Driver string `yaml:"driver"`
+	// MaxUploadBytes caps the size of one uploaded file.
+	MaxUploadBytes int64 `yaml:"max_upload_bytes"`
+	// ThumbnailSize is the longest side of generated thumbnails, in pixels.
+	ThumbnailSize int   `yaml:"thumbnail_size"`
+	Local         Local `yaml:"local"`
+	S3            S3    `yaml:"s3"`
+}
+
+// Local stores files in a directory the API serves itself.
+type Local struct {
+	Dir string `yaml:"dir"`
+	// URLPrefix is the path Dir is served under, such as /media.
+	URLPrefix string `yaml:"url_prefix"`
+}
+
+// S3 stores files in a bucket of AWS S3 or a compatible service such as MinIO.
+type S3 struct {
+	// Endpoint is the service URL, such as https://s3.us-east-1.amazonaws.com
+	// or http://localhost:9000 for MinIO.
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle addresses the bucket as endpoint/bucket rather than as
+	// bucket.endpoint. MinIO needs it unless set up with a domain.
+	PathStyle bool `yaml:"path_style"`
+	// PublicURL is where clients fetch objects from, such as a CDN in front of
+	// the bucket. Empty uses the bucket's own URL.
+	PublicURL string `yaml:"public_url"`
+}
+
+// Admin names an admin account the server creates at startup unless the email
+// is already registered. It is how the memory driver, which keeps nothing
+// between runs, gets an admin.
+type Admin struct {
+	Email string `yaml:"email"`
+	Name  string `yaml:"name"`
+	// PasswordFile holds the initial password, which must be changed at the
+	// first login. It is read from a file so it stays out of the environment.
+	PasswordFile string `yaml:"password_file"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            "8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			Driver:                 MongoDriver,
+			Host:                   "localhost:27017",
+			Name:                   "ecommerce",
+			ServerSelectionTimeout: 10 * time.Second,
+			ReadTimeout:            5 * time.Second,
+			WriteTimeout:           10 * time.Second,
+			AutoMigrate:            true,
+		},
+		Auth: Auth{
+			TokenExpiryHours:  48,
+			PrincipalCacheTTL: 30 * time.Second,
+		},
+		Email: Email{
+			Sender: "puneetvishnoiias@gmail.com",
+		},
+		Log: Log{
+			Level:  "info",
+			Format: JSONLogFormat,
+		},
+		Tracing: Tracing{
+			Exporter:    NoTraceExporter,
+			ServiceName: "ecommerce-api",
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+		},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+			ExposedHeaders: []string{"X-Request-ID", "Retry-After", "Deprecation", "Link"},
+			MaxAge:         10 * time.Minute,
+		},
+		Password: Password{
+			Algorithm:       BcryptAlgorithm,
+			BcryptCost:      12,
+			Argon2Time:      2,
+			Argon2MemoryKiB: 19 * 1024,
+			Argon2Threads:   1,
+			MinLength:       8,
+		},
+		Storage: Storage{
+			Driver:         LocalStorage,
+			MaxUploadBytes: 5 << 20,
+			ThumbnailSize:  320,
+			Local: Local{
+				Dir:       "uploads",
+				URLPrefix: "/media",
+			},
+			S3: S3{
+				Region:    "us-east-1",
+				PathStyle: true,
+			},
+		},
+		Admin: Admin{
+			Name: "Admin",
+		},
+	}
+}
+
+// Load reads .env, the optional YAML file and the environment, then validates the result.
+func Load() (*Config, error) {
+	// .env never overrides variables that are already set
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(".env"); err != nil {
+			return nil, fmt.Errorf("loading .env: %w", err)
+		}
+	}
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides cfg with every variable that is set. The names match the ones the
+// service has always read, so existing deployments keep working.
+func (cfg *Config) loadEnv() error {
+	e := envReader{}
+
+	e.str("PORT", &cfg.Server.Port)
+	e.str("API_VERSION", &cfg.Server.LegacyPrefix)
+	e.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	e.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	e.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+
+	e.str("DB_DRIVER", &cfg.Database.Driver)
+	e.str("MONGO_URI", &cfg.Database.URI)
+	e.str("BD_HOST", &cfg.Database.Host)
+	e.str("DATABASE_NAME", &cfg.Database.Name)
+	e.str("DB_USERNAME", &cfg.Database.Username)
+	e.str("DB_PASSWORD", &cfg.Database.Password)
+	e.str("DB_AUTH_SOURCE", &cfg.Database.AuthSource)
+	e.str("DB_REPLICA_SET", &cfg.Database.ReplicaSet)
+	e.bool("DB_TLS", &cfg.Database.TLS)
+	e.str("DB_TLS_CA_FILE", &cfg.Database.TLSCAFile)
+	e.str("DB_TLS_CERT_KEY_FILE", &cfg.Database.TLSCertKeyFile)
+	e.uint64("DB_MIN_POOL_SIZE", &cfg.Database.MinPoolSize)
+	e.uint64("DB_MAX_POOL_SIZE", &cfg.Database.MaxPoolSize)
+	e.duration("DB_MAX_CONN_IDLE_TIME", &cfg.Database.MaxConnIdleTime)
+	e.duration("DB_CONNECT_TIMEOUT", &cfg.Database.ConnectTimeout)
+	e.duration("DB_SERVER_SELECTION_TIMEOUT", &cfg.Database.ServerSelectionTimeout)
+	e.str("DB_READ_PREFERENCE", &cfg.Database.ReadPreference)
+	e.str("DB_WRITE_CONCERN", &cfg.Database.WriteConcern)
+	e.bool("DB_WRITE_CONCERN_JOURNAL", &cfg.Database.WriteConcernJournal)
+	e.duration("DB_READ_TIMEOUT", &cfg.Database.ReadTimeout)
+	e.duration("DB_WRITE_TIMEOUT", &cfg.Database.WriteTimeout)
+	e.bool("DB_AUTO_MIGRATE", &cfg.Database.AutoMigrate)
+
+	e.str("JwtSecrets", &cfg.Auth.JwtSecret)
+	e.str("JwtIssuer", &cfg.Auth.JwtIssuer)
+	e.int64("JwtExpirationHours", &cfg.Auth.TokenExpiryHours)
+	e.duration("AUTH_PRINCIPAL_CACHE_TTL", &cfg.Auth.PrincipalCacheTTL)
+
+	e.str("SENDGRID_API_KEY", &cfg.Email.SendGridAPIKey)
+	e.str("FROM_EMAIL", &cfg.Email.Sender)
+
+	e.str("LOG_LEVEL", &cfg.Log.Level)
+	e.str("LOG_FORMAT", &cfg.Log.Format)
+
+	e.str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	e.str("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	e.str("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	e.bool("OTEL_EXPORTER_OTLP_INSECURE", &cfg.Tracing.Insecure)
+	e.float64("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+
+	e.list("CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+	e.list("CORS_ALLOWED_METHODS", &cfg.CORS.AllowedMethods)
+	e.list("CORS_ALLOWED_HEADERS", &cfg.CORS.AllowedHeaders)
+	e.list("CORS_EXPOSED_HEADERS", &cfg.CORS.ExposedHeaders)
+	e.duration("CORS_MAX_AGE", &cfg.CORS.MaxAge)
+	e.bool("CORS_ALLOW_CREDENTIALS", &cfg.CORS.AllowCredentials)
+
+	e.str("PASSWORD_HASH_ALGORITHM", &cfg.Password.Algorithm)
+	e.int("BCRYPT_COST", &cfg.Password.BcryptCost)
+	e.int("ARGON2_TIME", &cfg.Password.Argon2Time)
+	e.int("ARGON2_MEMORY_KIB", &cfg.Password.Argon2MemoryKiB)
+	e.int("ARGON2_THREADS", &cfg.Password.Argon2Threads)
+	e.int("PASSWORD_MIN_LENGTH", &cfg.Password.MinLength)
+	e.str("PASSWORD_BREACHED_LIST", &cfg.Password.BreachedListFile)
+
+	e.str("STORAGE_DRIVER", &cfg.Storage.Driver)
+	e.int64("STORAGE_MAX_UPLOAD_BYTES", &cfg.Storage.MaxUploadBytes)
+	e.int("STORAGE_THUMBNAIL_SIZE", &cfg.Storage.ThumbnailSize)
+	e.str("STORAGE_LOCAL_DIR", &cfg.Storage.Local.Dir)
+	e.str("STORAGE_LOCAL_URL_PREFIX", &cfg.Storage.Local.URLPrefix)
+	e.str("S3_ENDPOINT", &cfg.Storage.S3.Endpoint)
+	e.str("S3_REGION", &cfg.Storage.S3.Region)
+	e.str("S3_BUCKET", &cfg.Storage.S3.Bucket)
+	e.str("S3_ACCESS_KEY_ID", &cfg.Storage.S3.AccessKeyID)
+	e.str("S3_SECRET_ACCESS_KEY", &cfg.Storage.S3.SecretAccessKey)
+	e.bool("S3_PATH_STYLE", &cfg.Storage.S3.PathStyle)
+	e.str("S3_PUBLIC_URL", &cfg.Storage.S3.PublicURL)
+
+	e.str("ADMIN_EMAIL", &cfg.Admin.Email)
+	e.str("ADMIN_NAME", &cfg.Admin.Name)
+	e.str("ADMIN_PASSWORD_FILE", &cfg.Admin.PasswordFile)
+
+	return errors.Join(e.errs...)
+}
+
+// Validate reports every missing or inconsistent setting at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if cfg.Server.Port == "" {
+		errs = append(errs, errors.New("PORT is required"))
+	}
+	if p := cfg.Server.LegacyPrefix; p != "" && (!strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/")) {
+		errs = append(errs, fmt.Errorf("API_VERSION must start with / and not end with one, got %q", p))
+	}
+	if cfg.Database.Driver != MongoDriver && cfg.Database.Driver != MemoryDriver {
+		errs = append(errs, fmt.Errorf("DB_DRIVER must be %q or %q, got %q", MongoDriver, MemoryDriver, cfg.Database.Driver))
+	}
+	if cfg.Database.Driver == MongoDriver && cfg.Database.URI == "" && cfg.Database.Host == "" {
+		errs = append(errs, errors.New("MONGO_URI or BD_HOST is required for the mongo driver"))
+	}
+	if cfg.Database.URI != "" && !strings.HasPrefix(cfg.Database.URI, "mongodb://") && !strings.HasPrefix(cfg.Database.URI, "mongodb+srv://") {
+		errs = append(errs, errors.New("MONGO_URI must start with mongodb:// or mongodb+srv://"))
+	}
+	if cfg.Database.Password != "" && cfg.Database.Username == "" {
+		errs = append(errs, errors.New("DB_PASSWORD is set without DB_USERNAME"))
+	}
+	if cfg.Database.MaxPoolSize > 0 && cfg.Database.MinPoolSize > cfg.Database.MaxPoolSize {
+		errs = append(errs, errors.New("DB_MIN_POOL_SIZE can't exceed DB_MAX_POOL_SIZE"))
+	}
+	if cfg.Database.ReadPreference != "" && !slices.Contains(readPreferences, cfg.Database.ReadPreference) {
+		errs = append(errs, fmt.Errorf("DB_READ_PREFERENCE must be one of %s", strings.Join(readPreferences, ", ")))
+	}
+	if cfg.Database.Name == "" {
+		errs = append(errs, errors.New("DATABASE_NAME is required"))
+	}
+	if cfg.Auth.JwtSecret == "" {
+		errs = append(errs, errors.New("JwtSecrets is required; tokens can't be signed with an empty key"))
+	}
+	if cfg.Auth.TokenExpiryHours <= 0 {
+		errs = append(errs, errors.New("JwtExpirationHours must be positive"))
+	}
+	if cfg.Auth.PrincipalCacheTTL < 0 {
+		errs = append(errs, errors.New("AUTH_PRINCIPAL_CACHE_TTL can't be negative"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", cfg.Log.Level))
+	}
+	if cfg.Log.Format != JSONLogFormat && cfg.Log.Format != TextLogFormat {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be %q or %q, got %q", JSONLogFormat, TextLogFormat, cfg.Log.Format))
+	}
+	switch cfg.Tracing.Exporter {
+	case NoTraceExporter, StdoutTraceExporter:
+	case OTLPTraceExporter:
+		if cfg.Tracing.Endpoint == "" {
+			errs = append(errs, errors.New("OTEL_EXPORTER_OTLP_ENDPOINT is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER must be %q, %q or %q, got %q", NoTraceExporter, OTLPTraceExporter, StdoutTraceExporter, cfg.Tracing.Exporter))
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+	switch cfg.Password.Algorithm {
+	case BcryptAlgorithm:
+		// bcrypt accepts 4 to 31; below 10 is too cheap to slow down guessing
+		if cfg.Password.BcryptCost < 10 || cfg.Password.BcryptCost > 31 {
+			errs = append(errs, fmt.Errorf("BCRYPT_COST must be between 10 and 31, got %d", cfg.Password.BcryptCost))
+		}
+	case Argon2idAlgorithm:
+		if cfg.Password.Argon2Time < 1 || cfg.Password.Argon2Threads < 1 || cfg.Password.Argon2Threads > 255 {
+			errs = append(errs, errors.New("ARGON2_TIME must be at least 1 and ARGON2_THREADS between 1 and 255"))
+		}
+		if cfg.Password.Argon2MemoryKiB < 8*cfg.Password.Argon2Threads {
+			errs = append(errs, errors.New("ARGON2_MEMORY_KIB must be at least 8 per thread"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PASSWORD_HASH_ALGORITHM must be %q or %q, got %q", BcryptAlgorithm, Argon2idAlgorithm, cfg.Password.Algorithm))
+	}
+	if cfg.Password.MinLength < 8 {
+		errs = append(errs, errors.New("PASSWORD_MIN_LENGTH must be at least 8"))
+	}
+	errs = append(errs, cfg.Storage.validate()...)
+	if (cfg.Admin.Email == "") != (cfg.Admin.PasswordFile == "") {
+		errs = append(errs, errors.New("ADMIN_EMAIL and ADMIN_PASSWORD_FILE must be set together"))
+	}
+	if cfg.Admin.Email != "" {
+		if _, err := mail.ParseAddress(cfg.Admin.Email); err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_EMAIL: %w", err))
+		}
+	}
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		if origin == "*" {
+			if cfg.CORS.AllowCredentials {
+				errs = append(errs, errors.New(`CORS_ALLOWED_ORIGINS can't be "*" with CORS_ALLOW_CREDENTIALS; list the origins`))
+			}
+			continue
+		}
+		if err := validOrigin(origin); err != nil {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: %w", err))
+		}
+	}
+	for name, d := range map[string]time.Duration{
+		"SERVER_READ_TIMEOUT":         cfg.Server.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":        cfg.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":         cfg.Server.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":            cfg.Server.ShutdownTimeout,
+		"DB_READ_TIMEOUT":             cfg.Database.ReadTimeout,
+		"DB_WRITE_TIMEOUT":            cfg.Database.WriteTimeout,
+		"DB_MAX_CONN_IDLE_TIME":       cfg.Database.MaxConnIdleTime,
+		"DB_CONNECT_TIMEOUT":          cfg.Database.ConnectTimeout,
+		"DB_SERVER_SELECTION_TIMEOUT": cfg.Database.ServerSelectionTimeout,
+		"CORS_MAX_AGE":                cfg.CORS.MaxAge,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s can't be negative", name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (s Storage) validate() []error {
+	var errs []error
+	switch s.Driver {
+	case LocalStorage:
+		if s.Local.Dir == "" {
+			errs = append(errs, errors.New("STORAGE_LOCAL_DIR is required for the local storage driver"))
+		}
+		if p := s.Local.URLPrefix; len(p) < 2 || !strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") {
+			errs = append(errs, fmt.Errorf("STORAGE_LOCAL_URL_PREFIX must start with / and not end with one, got %q", p))
+		}
+	case S3Storage:
+		if u, err := url.Parse(s.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("S3_ENDPOINT must be an http or https URL, got %q", s.S3.Endpoint))
+		}
+		if s.S3.Bucket == "" || s.S3.Region == "" {
+			errs = append(errs, errors.New("S3_BUCKET and S3_REGION are required for the s3 storage driver"))
+		}
+		if s.S3.AccessKeyID == "" || s.S3.SecretAccessKey == "" {
+			errs = append(errs, errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 storage driver"))
+		}
+		if u, err := url.Parse(s.S3.PublicURL); s.S3.PublicURL != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+			errs = append(errs, fmt.Errorf("S3_PUBLIC_URL must be an absolute URL, got %q", s.S3.PublicURL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_DRIVER must be %q or %q, got %q", LocalStorage, S3Storage, s.Driver))
+	}
+	if s.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("STORAGE_MAX_UPLOAD_BYTES must be positive"))
+	}
+	if s.ThumbnailSize < 16 || s.ThumbnailSize > 2048 {
+		errs = append(errs, fmt.Errorf("STORAGE_THUMBNAIL_SIZE must be between 16 and 2048, got %d", s.ThumbnailSize))
+	}
+	return errs
+}
+
+// validOrigin accepts scheme://host[:port], where the host may start with "*."
+// to admit its subdomains.
+func validOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("%q is not an origin like https://example.com", origin)
+	}
+	if host := strings.TrimPrefix(u.Host, "*."); strings.Contains(host, "*") {
+		return fmt.Errorf("%q may only use a wildcard as its leftmost label, e.g. https://*.example.com", origin)
+	}
+	return nil
+}
+
+// Middleware makes cfg available to handlers through FromContext.
+func (cfg *Config) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(contextKey, cfg)
+		c.Next()
+	}
+}
+
+// FromContext returns the config installed by Middleware.
+func FromContext(c *gin.Context) *Config {
+	return c.MustGet(contextKey).(*Config)
+}
+
+// envReader copies set environment variables into config fields, collecting parse errors.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) str(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = strings.TrimSpace(v)
+	}
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = d
+}
+
+func (e *envReader) int(key string, dst *int) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) int64(key string, dst *int64) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) uint64(key string, dst *uint64) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = b
+}
+
+func (e *envReader) float64(key string, dst *float64) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = f
+}
+
+// list reads a comma-separated value, dropping empty items.
+func (e *envReader) list(key string, dst *[]string) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads so the host environment can't leak into a test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, key := range []string{
+		"CONFIG_FILE", "PORT", "API_VERSION", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT",
+		"SERVER_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT", "TRUSTED_PROXIES", "DB_DRIVER", "BD_HOST", "DATABASE_NAME",
+		"DB_READ_TIMEOUT", "DB_WRITE_TIMEOUT", "MONGO_URI", "DB_USERNAME", "DB_PASSWORD",
+		"DB_AUTH_SOURCE", "DB_REPLICA_SET", "DB_TLS", "DB_TLS_CA_FILE", "DB_TLS_CERT_KEY_FILE",
+		"DB_MIN_POOL_SIZE", "DB_MAX_POOL_SIZE", "DB_MAX_CONN_IDLE_TIME", "DB_CONNECT_TIMEOUT",
+		"DB_SERVER_SELECTION_TIMEOUT", "DB_READ_PREFERENCE", "DB_WRITE_CONCERN", "DB_WRITE_CONCERN_JOURNAL", "DB_AUTO_MIGRATE",
+		"JwtSecrets", "JwtIssuer", "JwtExpirationHours", "AUTH_PRINCIPAL_CACHE_TTL",
+		"SENDGRID_API_KEY", "FROM_EMAIL", "LOG_LEVEL", "LOG_FORMAT",
+		"TRACING_EXPORTER", "OTEL_SERVICE_NAME", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_INSECURE", "TRACING_SAMPLE_RATIO",
+		"PASSWORD_HASH_ALGORITHM", "BCRYPT_COST", "ARGON2_TIME", "ARGON2_MEMORY_KIB", "ARGON2_THREADS",
+		"PASSWORD_MIN_LENGTH", "PASSWORD_BREACHED_LIST",
+		"CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_METHODS", "CORS_ALLOWED_HEADERS", "CORS_EXPOSED_HEADERS", "CORS_MAX_AGE", "CORS_ALLOW_CREDENTIALS",
+		"STORAGE_DRIVER", "STORAGE_MAX_UPLOAD_BYTES", "STORAGE_THUMBNAIL_SIZE", "STORAGE_LOCAL_DIR", "STORAGE_LOCAL_URL_PREFIX",
+		"S3_ENDPOINT", "S3_REGION", "S3_BUCKET", "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "S3_PATH_STYLE", "S3_PUBLIC_URL",
+		"ADMIN_EMAIL", "ADMIN_NAME", "ADMIN_PASSWORD_FILE",
+	} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestLoadRequiresJwtSecret(t *testing.T) {
+	clearEnv(t)
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "JwtSecrets") {
+		t.Fatalf("Load() error = %v, want missing JwtSecrets", err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+server:
+  port: "9000"
+  legacy_prefix: /api/v1
+  read_timeout: 3s
+database:
+  driver: memory
+  name: from_file
+auth:
+  jwt_secret: file-secret
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DATABASE_NAME", "from_env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Server.Port != "9000" || cfg.Server.ReadTimeout != 3*time.Second {
+		t.Errorf("server = %+v, want values from the file", cfg.Server)
+	}
+	if cfg.Database.Name != "from_env" {
+		t.Errorf("database name = %q, want the environment to win over the file", cfg.Database.Name)
+	}
+	if cfg.Database.WriteTimeout != 10*time.Second {
+		t.Errorf("write timeout = %s, want the default", cfg.Database.WriteTimeout)
+	}
+	if cfg.Auth.JwtSecret != "file-secret" {
+		t.Errorf("jwt secret not read from the file")
+	}
+}
+
+func TestLoadRejectsBadValues(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("DB_DRIVER", "postgres")
+	t.Setenv("DB_READ_TIMEOUT", "soon")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "DB_READ_TIMEOUT") {
+		t.Fatalf("Load() error = %v, want bad DB_READ_TIMEOUT", err)
+	}
+
+	t.Setenv("DB_READ_TIMEOUT", "")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "DB_DRIVER") {
+		t.Fatalf("Load() error = %v, want bad DB_DRIVER", err)
+	}
+}
+
+func TestLoadValidatesTracing(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("TRACING_EXPORTER", "jaeger")
+	t.Setenv("TRACING_SAMPLE_RATIO", "1.5")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "TRACING_EXPORTER") || !strings.Contains(err.Error(), "TRACING_SAMPLE_RATIO") {
+		t.Fatalf("Load() error = %v, want bad exporter and sample ratio", err)
+	}
+
+	t.Setenv("TRACING_EXPORTER", "otlp")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "collector:4318")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Tracing.Endpoint != "collector:4318" || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("tracing = %+v", cfg.Tracing)
+	}
+}
+
+func TestLoadValidatesCORS(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*, shop.example.com, https://a.*.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	_, err := Load()
+	for _, want := range []string{`can't be "*"`, "shop.example.com", "a.*.example.com"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, want it to mention %s", err, want)
+		}
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://shop.example.com, https://*.example.com")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || !cfg.CORS.AllowCredentials {
+		t.Errorf("cors = %+v", cfg.CORS)
+	}
+}
+
+func TestLoadValidatesPassword(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("PASSWORD_MIN_LENGTH", "4")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "BCRYPT_COST") || !strings.Contains(err.Error(), "PASSWORD_MIN_LENGTH") {
+		t.Fatalf("Load() error = %v, want weak cost and length", err)
+	}
+
+	t.Setenv("BCRYPT_COST", "")
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "argon2id")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Password.Algorithm != Argon2idAlgorithm || cfg.Password.MinLength != 12 {
+		t.Errorf("password = %+v", cfg.Password)
+	}
+}
+
+func TestLoadValidatesStorage(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("STORAGE_DRIVER", "s3")
+	t.Setenv("S3_ENDPOINT", "localhost:9000")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "S3_ENDPOINT") || !strings.Contains(err.Error(), "S3_BUCKET") || !strings.Contains(err.Error(), "S3_ACCESS_KEY_ID") {
+		t.Fatalf("Load() error = %v, want endpoint, bucket and credentials", err)
+	}
+
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "media")
+	t.Setenv("S3_ACCESS_KEY_ID", "minio")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "minio-secret")
+	t.Setenv("STORAGE_MAX_UPLOAD_BYTES", "1048576")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Storage.Driver != S3Storage || cfg.Storage.S3.Region != "us-east-1" || !cfg.Storage.S3.PathStyle || cfg.Storage.MaxUploadBytes != 1<<20 {
+		t.Errorf("storage = %+v", cfg.Storage)
+	}
+}
+
+func TestLoadValidatesAdmin(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("JwtSecrets", "secret")
+	t.Setenv("ADMIN_EMAIL", "not an address")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "ADMIN_EMAIL:") || !strings.Contains(err.Error(), "ADMIN_PASSWORD_FILE") {
+		t.Fatalf("Load() error = %v, want a bad address and a missing password file", err)
+	}
+
+	t.Setenv("ADMIN_EMAIL", "root@shop.example.com")
+	t.Setenv("ADMIN_PASSWORD_FILE", "/run/secrets/admin_password")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Admin != (Admin{Email: "root@shop.example.com", Name: "Admin", PasswordFile: "/run/secrets/admin_password"}) {
+		t.Errorf("admin = %+v", cfg.Admin)
+	}
+}
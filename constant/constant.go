@@ -2,14 +2,52 @@ package constant
 
 const (
 	APIVersion = "v1"
+	// APIPrefix is where the versioned resource routes are mounted.
+	APIPrefix = "/api/" + APIVersion
 
 	BadRequestMessage = "request not fulfilled"
 
-	// schedular constants
-	HealthCheckRoute = "/health"
-	MDBUri           = "localhost:27017"
-	Database         = "ecommerce"
-	Sender           = "puneetvishnoiias@gmail.com"
+	// probe and metrics routes, registered outside the API version prefix
+	HealthCheckRoute = "/healthz"
+	ReadinessRoute   = "/readyz"
+	MetricsRoute     = "/metrics"
+
+	// API documentation, also outside the version prefix
+	OpenAPIRoute     = "/openapi.json"
+	DocsRoute        = "/docs"
+	DocsAssetsPrefix = "/docs/assets"
+
+	// v1 resource routes, relative to APIPrefix
+	AuthVerifyEmailRoute = "/auth/verify-email"
+	AuthVerifyOtpRoute   = "/auth/verify-otp"
+	AuthResendEmailRoute = "/auth/resend-email"
+	AuthLoginRoute       = "/auth/login"
+	UsersRoute           = "/users"
+	UserRoute            = "/users/:id"
+	UserEmailRoute       = "/users/:id/email"
+	UserEmailVerifyRoute = "/users/:id/email/verify"
+	ProductsRoute        = "/products"
+	ProductRoute         = "/products/:id"
+	CartRoute            = "/cart"
+	AddressesRoute       = "/addresses"
+	OrdersRoute          = "/orders"
+	OrderDeliveredRoute  = "/orders/:id/delivered"
+	ProductReviewsRoute  = "/products/:id/reviews"
+	ReviewModerateRoute  = "/reviews/:id/moderation"
+	WishlistsRoute       = "/wishlists"
+	WishlistRoute        = "/wishlists/:id"
+	WishlistItemsRoute   = "/wishlists/:id/items"
+	WishlistItemRoute    = "/wishlists/:id/items/:productId"
+	WishlistMoveRoute    = "/wishlists/:id/items/:productId/move-to-cart"
+	WishlistShareRoute   = "/wishlists/:id/share"
+	SharedWishlistRoute  = "/shared/wishlists/:token"
+	ProductImagesRoute   = "/products/:id/images"
+	ProductImageRoute    = "/products/:id/images/:imageId"
+
+	// Legacy routes, still served under the API_VERSION prefix as deprecated aliases.
+	// Their groups are /ecommerce and /ecommerce-product.
+	LegacyGroup        = "/ecommerce"
+	LegacyProductGroup = "/ecommerce-product"
 
 	// email verification routes
 	VerifyEmailRoute = "/verify-email"
@@ -50,6 +88,25 @@ const (
 	ProductCollection       = "products"
 	AddressCollection       = "user_addresses"
 	CartCollection          = "user_cart"
+	ReviewCollection        = "reviews"
+	WishlistCollection      = "wishlists"
+)
+
+// product list sort keys
+const (
+	SortByRating = "rating"
+)
+
+const (
+	MinRating       = 1
+	MaxRating       = 5
+	MaxReviewLength = 2000
+
+	MaxWishlists          = 20
+	MaxWishlistItems      = 200
+	MaxWishlistNameLength = 100
+
+	MaxProductImages = 20
 )
 
 // messages
@@ -67,4 +124,33 @@ const (
 	NoProductAvaliable           = "no product avaliable"
 	UserDoesNotExists            = "user not exists"
 	AddressNotExists             = "address not exists. please add one address"
+	TooManyRequestsError         = "too many requests, please try again later"
+	PasswordChangeRequiredError  = "you must change your password before doing this"
+	SamePasswordError            = "choose a password different from the current one"
+	EmailChangeNeedsVerification = "email can't be changed here; request the change at /users/:id/email and confirm the code sent to the new address"
+	SameEmailError               = "that is already the account's email"
+	NoPendingEmailChange         = "no email change is pending"
+	ReviewNeedsDeliveredOrder    = "you can only review products you have received"
+	RatingRangeError             = "rating must be between 1 and 5"
+	ReviewTooLongError           = "review text is too long"
+	ReviewNotExists              = "review not exists"
+	OrderNotExists               = "no checked-out order line with that id"
+	UnknownSortError             = "unknown sort key"
+	WishlistNotExists            = "wishlist not exists"
+	WishlistNameError            = "wishlist name must be 1 to 100 characters"
+	WishlistNameTaken            = "you already have a wishlist with this name"
+	TooManyWishlists             = "you can't have more than 20 wishlists"
+	WishlistFull                 = "a wishlist can't hold more than 200 products"
+	NotInWishlist                = "product is not in this wishlist"
+	SKUTakenError                = "sku is already used by another product"
+	VariantRequired              = "this product comes in variants; choose one by sku"
+	VariantNotExists             = "product has no variant with that sku"
+	VariantOutOfStock            = "this variant is out of stock"
+	ProductHasNoVariants         = "this product has no variants; leave sku empty"
+	ImageFieldRequired           = "send the image as the multipart form field \"image\""
+	ImageTooLarge                = "image is larger than the upload limit"
+	TooManyProductImages         = "a product can't have more than 20 images"
+	ProductImageNotExists        = "product has no image with that id"
+	ImageOrderError              = "image_ids must list every image of the product exactly once"
+	ProductImagesChanged         = "the product's images changed; reload them and try again"
 )
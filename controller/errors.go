@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"ecommerce-project/database"
+	"net/http"
+)
+
+// errorStatus picks the HTTP status for a failed database call.
+// Calls that ran past their deadline map to 504 so clients can tell a slow
+// backend from a bad request; anything else keeps the handler's usual status.
+func errorStatus(err error, fallback int) int {
+	if database.IsTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return fallback
+}
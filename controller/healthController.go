@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+	"ecommerce-project/database"
+	"ecommerce-project/helper"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds each dependency check so a hung backend fails the probe instead of stalling it.
+const readinessTimeout = 2 * time.Second
+
+// HealthCheck reports that the process is up and serving requests. It checks no dependencies.
+func HealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// ReadinessCheck reports whether the dependencies needed to serve traffic are usable.
+// It responds 503 with the failing checks when any of them is not.
+func ReadinessCheck(c *gin.Context) {
+	checks := map[string]func(context.Context) error{
+		"database": database.Mgr.Ping,
+		"email": func(context.Context) error {
+			return helper.Mailer.Ready()
+		},
+	}
+
+	status := http.StatusOK
+	results := gin.H{}
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		err := check(ctx)
+		cancel()
+
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			results[name] = gin.H{"status": "unavailable", "error": err.Error()}
+			continue
+		}
+		results[name] = gin.H{"status": "ok"}
+	}
+
+	overall := "ok"
+	if status != http.StatusOK {
+		overall = "unavailable"
+	}
+	c.JSON(status, gin.H{"status": overall, "checks": results})
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"context"
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/imaging"
+	"ecommerce-project/storage"
+	"ecommerce-project/types"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// multipartOverhead is what the multipart framing around an upload may add
+// to the request body beyond the file itself.
+const multipartOverhead = 64 << 10
+
+// extensions maps the content types imaging produces to file extensions.
+var extensions = map[string]string{
+	imaging.JPEG: ".jpg",
+	imaging.PNG:  ".png",
+	imaging.GIF:  ".gif",
+}
+
+// UploadProductImage adds the image in the multipart field "image" to the end
+// of the gallery of the product named by the id path parameter. The image is
+// identified by its content, not the type the client claims, and stored with
+// a thumbnail. The gallery limit is checked again as the image is added, so
+// concurrent uploads can't exceed it.
+func UploadProductImage(c *gin.Context) {
+	product, ok := imageProduct(c)
+	if !ok {
+		return
+	}
+	if len(product.Images) >= constant.MaxProductImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.TooManyProductImages})
+		return
+	}
+
+	cfg := config.FromContext(c).Storage
+	data, ok := readUpload(c, cfg.MaxUploadBytes)
+	if !ok {
+		return
+	}
+	info, err := imaging.Inspect(data)
+	if errors.Is(err, imaging.ErrUnsupportedType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	thumb, thumbType, err := imaging.Thumbnail(data, cfg.ThumbnailSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	id := primitive.NewObjectID().Hex()
+	prefix := "products/" + product.Id.Hex() + "/" + id
+	image := types.ProductImage{
+		ID:           id,
+		ContentType:  info.ContentType,
+		Width:        info.Width,
+		Height:       info.Height,
+		Size:         int64(len(data)),
+		Key:          prefix + extensions[info.ContentType],
+		ThumbnailKey: prefix + "_thumb" + extensions[thumbType],
+		CreatedAt:    time.Now().Unix(),
+	}
+	image.URL = storage.Files.URL(image.Key)
+	image.ThumbnailURL = storage.Files.URL(image.ThumbnailKey)
+
+	ctx := c.Request.Context()
+	err = storage.Files.Put(ctx, image.Key, data, info.ContentType)
+	if err == nil {
+		err = storage.Files.Put(ctx, image.ThumbnailKey, thumb, thumbType)
+	}
+	if err == nil {
+		err = database.Mgr.AddProductImage(ctx, product.Id, image, constant.MaxProductImages, image.CreatedAt, constant.ProductCollection)
+	}
+	if err != nil {
+		deleteImageFiles(ctx, []types.ProductImage{image})
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.TooManyProductImages})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": image})
+}
+
+// DeleteProductImage removes the image named by the imageId path parameter
+// from a product's gallery and from storage.
+func DeleteProductImage(c *gin.Context) {
+	product, ok := imageProduct(c)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(product.Images, func(image types.ProductImage) bool { return image.ID == c.Param("imageId") })
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.ProductImageNotExists})
+		return
+	}
+
+	err := database.Mgr.RemoveProductImage(c.Request.Context(), product.Id, product.Images[i].ID, time.Now().Unix(), constant.ProductCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	deleteImageFiles(c.Request.Context(), product.Images[i:i+1])
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
+}
+
+// ReorderProductImages puts a product's gallery in the order of the image IDs
+// in the body, which must name every image once. It answers 409 if an image
+// was added or removed meanwhile.
+func ReorderProductImages(c *gin.Context) {
+	product, ok := imageProduct(c)
+	if !ok {
+		return
+	}
+	var req types.ProductImageOrder
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	if len(req.ImageIDs) != len(product.Images) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.ImageOrderError})
+		return
+	}
+	byId := make(map[string]types.ProductImage, len(product.Images))
+	for _, image := range product.Images {
+		byId[image.ID] = image
+	}
+	images := make([]types.ProductImage, 0, len(req.ImageIDs))
+	for _, id := range req.ImageIDs {
+		image, ok := byId[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.ImageOrderError})
+			return
+		}
+		delete(byId, id)
+		images = append(images, image)
+	}
+
+	if len(images) == 0 {
+		c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": images})
+		return
+	}
+	err := database.Mgr.SetProductImages(c.Request.Context(), product.Id, images, time.Now().Unix(), constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.ProductImagesChanged})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": images})
+}
+
+// imageProduct loads the product named by the id path parameter. On failure it
+// responds and returns false.
+func imageProduct(c *gin.Context) (types.Product, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return types.Product{}, false
+	}
+	product, err := database.Mgr.GetSingleProductById(c.Request.Context(), id, constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NoProductAvaliable})
+		return types.Product{}, false
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return types.Product{}, false
+	}
+	return product, true
+}
+
+// readUpload reads the file in the multipart field "image", refusing bodies
+// larger than limit before reading them in full. On failure it responds and
+// returns false.
+func readUpload(c *gin.Context, limit int64) ([]byte, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+	header, err := c.FormFile("image")
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": true, "message": constant.ImageTooLarge})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.ImageFieldRequired})
+		return nil, false
+	case header.Size > limit:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": true, "message": constant.ImageTooLarge})
+		return nil, false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return nil, false
+	}
+	if int64(len(data)) > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": true, "message": constant.ImageTooLarge})
+		return nil, false
+	}
+	return data, true
+}
+
+// deleteImageFiles removes the files of images from storage. Failures only
+// leave orphaned files behind, so they are logged rather than returned. It
+// carries on after the request is cancelled so a disconnect doesn't leave
+// files half removed.
+func deleteImageFiles(ctx context.Context, images []types.ProductImage) {
+	ctx = context.WithoutCancel(ctx)
+	for _, image := range images {
+		for _, key := range []string{image.Key, image.ThumbnailKey} {
+			if err := storage.Files.Delete(ctx, key); err != nil {
+				slog.WarnContext(ctx, "deleting stored image", "key", key, "err", err)
+			}
+		}
+	}
+}
@@ -1,28 +1,26 @@
 package controller
 
 import (
+	"context"
+	"ecommerce-project/auth"
 	"ecommerce-project/constant"
 	"ecommerce-project/database"
 	"ecommerce-project/helper"
+	"ecommerce-project/metrics"
 	"ecommerce-project/types"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func RegisterProduct(c *gin.Context) {
-	userEmail, ok := c.Get("email")
-
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotRegisteredUser})
-		return
-	}
-
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(userEmail.(string), constant.UserCollection)
-
-	if userResp.UserType != constant.AdminUser {
+	if !auth.MustPrincipal(c).IsAdmin() {
 		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotAuthorizedUserError})
 		return
 	}
@@ -43,40 +41,128 @@ func RegisterProduct(c *gin.Context) {
 		return
 	}
 
+	err = helper.CheckVariantValidation(productRequest.Options, productRequest.Variants)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !skusAvailable(c, primitive.NilObjectID, productRequest.Variants) {
+		return
+	}
+
 	p.Name = productRequest.Name
 	p.Description = productRequest.Description
 	p.ImageUrl = productRequest.ImageUrl
 	p.Price = productRequest.Price
 	p.MetaInfo = productRequest.MetaInfo
+	p.Options = productRequest.Options
+	p.Variants = productRequest.Variants
 	p.CreatedAt = time.Now().Unix()
 	p.UpdatedAt = time.Now().Unix()
 
-	id, err := database.Mgr.Insert(p, constant.ProductCollection)
-
-	p.Id = id.(primitive.ObjectID)
+	id, err := database.Mgr.Insert(c.Request.Context(), p, constant.ProductCollection)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.SKUTakenError})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": p})
+	p.Id = id.(primitive.ObjectID)
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": p.WithPriceRange()})
+}
+
+// skusAvailable reports whether none of the variants' SKUs belongs to a product
+// other than the one with id. If one does it responds with 409 and returns false.
+// The unique index on variants.sku backs this up against concurrent writes.
+func skusAvailable(c *gin.Context, id primitive.ObjectID, variants []types.Variant) bool {
+	for _, v := range variants {
+		owner, err := database.Mgr.GetProductBySKU(c.Request.Context(), v.SKU, constant.ProductCollection)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+			return false
+		}
+		if owner.Id != id {
+			c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.SKUTakenError})
+			return false
+		}
+	}
+	return true
+}
+
+// withPriceRanges fills in the price range of each product that has variants.
+func withPriceRanges(products []types.Product) []types.Product {
+	for i := range products {
+		products[i] = products[i].WithPriceRange()
+	}
+	return products
 }
 
+// ListProductsController lists products a page at a time. With a search query
+// parameter it filters them like SearchProduct.
 func ListProductsController(c *gin.Context) {
+	if c.Query("search") != "" {
+		SearchProduct(c)
+		return
+	}
+
 	page := c.DefaultQuery("page", "1")
 	limit := c.DefaultQuery("limit", "10")
 	offset := c.DefaultQuery("offset", "0")
 
+	sort, ok := productSort(c)
+	if !ok {
+		return
+	}
+
 	pageInt := helper.ConvertStringIntoInt(page)
 	limitInt := helper.ConvertStringIntoInt(limit)
 	offsetInt := helper.ConvertStringIntoInt(offset)
 
-	dbResp, count, err := database.Mgr.GetListProducts(pageInt, limitInt, offsetInt, constant.ProductCollection)
+	dbResp, count, err := database.Mgr.GetListProducts(c.Request.Context(), pageInt, limitInt, offsetInt, sort, constant.ProductCollection)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": map[string]interface{}{"products": withPriceRanges(dbResp), "totalcount": count}})
+}
+
+// productSort reads the sort query parameter. For an unknown key it responds
+// with 400 and returns false.
+func productSort(c *gin.Context) (string, bool) {
+	sort := c.Query("sort")
+	if sort != "" && sort != constant.SortByRating {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.UnknownSortError})
+		return "", false
+	}
+	return sort, true
+}
+
+// GetProduct returns the product named by the id path parameter.
+func GetProduct(c *gin.Context) {
+	objId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	product, err := database.Mgr.GetSingleProductById(c.Request.Context(), objId, constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NoProductAvaliable})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": map[string]interface{}{"products": dbResp, "totalcount": count}})
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": product.WithPriceRange()})
 }
 
 func SearchProduct(c *gin.Context) {
@@ -84,32 +170,28 @@ func SearchProduct(c *gin.Context) {
 	limit := c.DefaultQuery("limit", "10")
 	offset := c.DefaultQuery("offset", "0")
 	s := c.Query("search")
+	sort, ok := productSort(c)
+	if !ok {
+		return
+	}
 
 	pageInt := helper.ConvertStringIntoInt(page)
 	limitInt := helper.ConvertStringIntoInt(limit)
 	offsetInt := helper.ConvertStringIntoInt(offset)
 
-	dbResp, count, err := database.Mgr.SearchProduct(pageInt, limitInt, offsetInt, s, constant.ProductCollection)
+	dbResp, count, err := database.Mgr.SearchProduct(c.Request.Context(), pageInt, limitInt, offsetInt, s, sort, constant.ProductCollection)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": map[string]interface{}{"products": dbResp, "totalcount": count}})
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": map[string]interface{}{"products": withPriceRanges(dbResp), "totalcount": count}})
 
 }
 
 func UpdateProduct(c *gin.Context) {
-	userEmail, ok := c.Get("email")
-
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotRegisteredUser})
-		return
-	}
-
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(userEmail.(string), constant.UserCollection)
-
-	if userResp.UserType != constant.AdminUser {
+	if !auth.MustPrincipal(c).IsAdmin() {
 		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotAuthorizedUserError})
 		return
 	}
@@ -122,6 +204,10 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	// the v1 route names the product in the path; the legacy one in the body
+	if id := c.Param("id"); id != "" {
+		updatedReq.ID = id
+	}
 	objId, err := primitive.ObjectIDFromHex(updatedReq.ID)
 
 	if err != nil {
@@ -129,10 +215,10 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	productResp, err := database.Mgr.GetSingleProductById(objId, constant.ProductCollection)
+	productResp, err := database.Mgr.GetSingleProductById(c.Request.Context(), objId, constant.ProductCollection)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
 
@@ -160,9 +246,27 @@ func UpdateProduct(c *gin.Context) {
 		req.Price = updatedReq.Price
 	}
 
-	err = database.Mgr.UpdateProduct(req, constant.ProductCollection)
+	if updatedReq.Variants != nil {
+		err = helper.CheckVariantValidation(updatedReq.Options, *updatedReq.Variants)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+			return
+		}
+		if !skusAvailable(c, req.Id, *updatedReq.Variants) {
+			return
+		}
+		// left nil otherwise, so UpdateProduct keeps the stored stock counts
+		req.Options = updatedReq.Options
+		req.Variants = *updatedReq.Variants
+	}
+
+	err = database.Mgr.UpdateProduct(c.Request.Context(), req, constant.ProductCollection)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.SKUTakenError})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
 
@@ -170,21 +274,16 @@ func UpdateProduct(c *gin.Context) {
 }
 
 func DeleteProduct(c *gin.Context) {
-	userEmail, ok := c.Get("email")
-
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotRegisteredUser})
-		return
-	}
-
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(userEmail.(string), constant.UserCollection)
-
-	if userResp.UserType != constant.AdminUser {
+	if !auth.MustPrincipal(c).IsAdmin() {
 		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotAuthorizedUserError})
 		return
 	}
 
-	id := c.Query("id")
+	// the v1 route names the product in the path; the legacy one in the query
+	id := c.Param("id")
+	if id == "" {
+		id = c.Query("id")
+	}
 
 	objId, err := primitive.ObjectIDFromHex(id)
 
@@ -193,10 +292,10 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	productResp, err := database.Mgr.GetSingleProductById(objId, constant.ProductCollection)
+	productResp, err := database.Mgr.GetSingleProductById(c.Request.Context(), objId, constant.ProductCollection)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
 	if productResp.Name == "" {
@@ -204,34 +303,91 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	err = database.Mgr.DeleteProduct(objId, constant.ProductCollection)
+	err = database.Mgr.DeleteProduct(c.Request.Context(), objId, constant.ProductCollection)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
+	deleteImageFiles(c.Request.Context(), productResp.Images)
 	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
 }
 
+// CheckoutOrder checks out the caller's cart. Every line naming a variant takes
+// a unit of its stock first; if one has run out, the units already taken go
+// back and nothing is checked out. Only the lines read here are checked out,
+// and a line a concurrent checkout got to first gives its unit back.
 func CheckoutOrder(c *gin.Context) {
-	userEmail, ok := c.Get("email")
-
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.NotRegisteredUser})
+	ctx := c.Request.Context()
+	userId := auth.MustPrincipal(c).ID
+	lines, err := database.Mgr.GetCartObjectListForUser(ctx, userId, constant.CartCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
 
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(userEmail.(string), constant.UserCollection)
-	if userResp.Email == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": constant.UserDoesNotExists})
+	var ids []primitive.ObjectID
+	var taken []types.Cart
+	for _, line := range lines {
+		if line.Checkout {
+			continue
+		}
+		ids = append(ids, line.Id)
+		if line.SKU == "" {
+			continue
+		}
+		err := database.Mgr.AdjustVariantStock(ctx, line.ProductID, line.SKU, -1, constant.ProductCollection)
+		if err != nil {
+			returnStock(ctx, taken)
+			status := errorStatus(err, http.StatusInternalServerError)
+			message := err.Error()
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				status, message = http.StatusConflict, constant.VariantOutOfStock
+			}
+			c.JSON(status, gin.H{"error": true, "message": message})
+			return
+		}
+		taken = append(taken, line)
+	}
+
+	marked, err := database.Mgr.UpdateCartToCheckout(ctx, userId, ids, constant.CartCollection)
+	returnStock(ctx, slices.DeleteFunc(taken, func(line types.Cart) bool { return slices.Contains(marked, line.Id) }))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"err": true, "message": err.Error()})
 		return
 	}
 
-	err := database.Mgr.UpdateCartToCheckout(userResp.Id, constant.CartCollection)
+	metrics.Checkouts.Inc()
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
+}
+
+// returnStock gives back the unit of stock each cart line took. A failure
+// only undersells the variant, so it is logged rather than returned.
+func returnStock(ctx context.Context, lines []types.Cart) {
+	ctx = context.WithoutCancel(ctx)
+	for _, line := range lines {
+		if err := database.Mgr.AdjustVariantStock(ctx, line.ProductID, line.SKU, 1, constant.ProductCollection); err != nil {
+			slog.WarnContext(ctx, "returning variant stock", "product_id", line.ProductID.Hex(), "sku", line.SKU, "err", err)
+		}
+	}
+}
 
+// MarkOrderDelivered records that a checked-out cart line named by the id path
+// parameter has been delivered, which lets its buyer review the product.
+func MarkOrderDelivered(c *gin.Context) {
+	objId, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"err": true, "message": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
+	err = database.Mgr.MarkCartDelivered(c.Request.Context(), objId, time.Now().Unix(), constant.CartCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.OrderNotExists})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
 }
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"ecommerce-project/auth"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/helper"
+	"ecommerce-project/types"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PutReview creates or edits the caller's review of the product named by the
+// id path parameter. Only users with a delivered order of the product may
+// review it.
+func PutReview(c *gin.Context) {
+	productId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	var req types.ReviewClient
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if req.Rating < constant.MinRating || req.Rating > constant.MaxRating {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.RatingRangeError})
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > constant.MaxReviewLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.ReviewTooLongError})
+		return
+	}
+
+	_, err = database.Mgr.GetSingleProductById(c.Request.Context(), productId, constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NoProductAvaliable})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	principal := auth.MustPrincipal(c)
+	delivered, err := database.Mgr.HasDeliveredProduct(c.Request.Context(), principal.ID, productId, constant.CartCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !delivered {
+		c.JSON(http.StatusForbidden, gin.H{"error": true, "message": constant.ReviewNeedsDeliveredOrder})
+		return
+	}
+
+	now := time.Now().Unix()
+	review, err := database.Mgr.UpsertReview(c.Request.Context(), types.Review{
+		ProductID: productId,
+		UserId:    principal.ID,
+		UserName:  principal.Name,
+		Rating:    req.Rating,
+		Text:      req.Text,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, constant.ReviewCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	refreshRating(c.Request.Context(), productId)
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": review})
+}
+
+// ListReviews lists the visible reviews of the product named by the id path
+// parameter, most recently updated first.
+func ListReviews(c *gin.Context) {
+	productId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	page := helper.ConvertStringIntoInt(c.DefaultQuery("page", "1"))
+	limit := helper.ConvertStringIntoInt(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+
+	reviews, count, err := database.Mgr.GetReviewsForProduct(c.Request.Context(), productId, page, limit, constant.ReviewCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if reviews == nil {
+		reviews = []types.Review{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": types.ReviewList{Reviews: reviews, TotalCount: count}})
+}
+
+// ModerateReview hides or restores the review named by the id path parameter.
+// Hidden reviews drop out of listings and the product's rating. Every
+// decision is logged as an audit record.
+func ModerateReview(c *gin.Context) {
+	reviewId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	var req types.ReviewModeration
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	review, err := database.Mgr.SetReviewHidden(c.Request.Context(), reviewId, req.Hidden, req.Reason, constant.ReviewCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.ReviewNotExists})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "audit",
+		slog.String("action", "review.moderate"),
+		slog.String("actor_id", auth.MustPrincipal(c).ID.Hex()),
+		slog.String("review_id", reviewId.Hex()),
+		slog.Bool("hidden", req.Hidden),
+		slog.String("reason", req.Reason),
+	)
+	refreshRating(c.Request.Context(), review.ProductID)
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": review})
+}
+
+// refreshRating recomputes the product's denormalized rating from its visible
+// reviews. The review change has already been stored, so a failure here is
+// only logged; the next review change corrects the rating.
+func refreshRating(ctx context.Context, productId primitive.ObjectID) {
+	err := database.Mgr.RefreshProductRating(ctx, productId, constant.ReviewCollection, constant.ProductCollection)
+	if err != nil {
+		slog.WarnContext(ctx, "updating product rating", "product_id", productId.Hex(), "err", err)
+	}
+}
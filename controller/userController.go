@@ -2,18 +2,22 @@ package controller
 
 import (
 	"ecommerce-project/auth"
+	"ecommerce-project/config"
 	"ecommerce-project/constant"
 	"ecommerce-project/database"
 	"ecommerce-project/helper"
+	"ecommerce-project/metrics"
+	"ecommerce-project/password"
 	"ecommerce-project/types"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/mail"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // VerifyEmail validates an email address and handles OTP generation/expiration
@@ -24,7 +28,7 @@ func VerifyEmail(c *gin.Context) {
 	postBodyErr := c.BindJSON(&req)
 	if postBodyErr != nil {
 		// Return a 400 error if the request payload is invalid
-		log.Println(postBodyErr)
+		slog.WarnContext(c.Request.Context(), "invalid request body", "err", postBodyErr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": postBodyErr.Error()})
 		return
 	}
@@ -36,22 +40,30 @@ func VerifyEmail(c *gin.Context) {
 	}
 
 	// Fetch the existing OTP record from the database
-	resp := database.Mgr.GetSingleRecordByEmail(req.Email, constant.VerificationsCollection)
+	resp, err := database.Mgr.GetSingleRecordByEmail(c.Request.Context(), req.Email, constant.VerificationsCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 
 	if resp.Otp != 0 {
 		// If an OTP already exists, check if it is expired
 		expirationTime := resp.CreatedAt + constant.OtpValidation
 		if expirationTime < time.Now().Unix() {
 			// Generate and send a new OTP using a helper function
-			req, checkEmail := helper.SendEmailSendGrid(req)
+			req, checkEmail := helper.Mailer.SendOtp(c.Request.Context(), req)
 			if checkEmail != nil {
-				log.Panicln(checkEmail)
+				slog.ErrorContext(c.Request.Context(), "sending otp", "err", checkEmail)
 				c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailValidationError})
 				return
 			}
 			// Update the record with the new OTP creation time
 			req.CreatedAt = time.Now().Unix()
-			database.Mgr.UpdateVerification(req, constant.VerificationsCollection)
+			if err := database.Mgr.UpdateVerification(c.Request.Context(), req, constant.VerificationsCollection); err != nil {
+				c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+				return
+			}
+			metrics.OtpsSent.Inc()
 			c.JSON(http.StatusOK, gin.H{"error": false, "message": "OTP sent successfully"})
 			return
 		}
@@ -61,16 +73,20 @@ func VerifyEmail(c *gin.Context) {
 	}
 
 	// Generate a new OTP as no prior OTP exists
-	req, checkEmail := helper.SendEmailSendGrid(req)
+	req, checkEmail := helper.Mailer.SendOtp(c.Request.Context(), req)
 	if checkEmail != nil {
-		log.Println(checkEmail)
+		slog.ErrorContext(c.Request.Context(), "sending otp", "err", checkEmail)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailValidationError})
 		return
 	}
 
 	// Record the OTP creation time and save it in the database
 	req.CreatedAt = time.Now().Unix()
-	database.Mgr.Insert(req, constant.VerificationsCollection)
+	if _, err := database.Mgr.Insert(c.Request.Context(), req, constant.VerificationsCollection); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	metrics.OtpsSent.Inc()
 	c.JSON(http.StatusOK, gin.H{"error": false, "message": "OTP sent successfully"})
 }
 
@@ -81,7 +97,7 @@ func VerifyOtp(c *gin.Context) {
 	// Parse and bind the incoming JSON payload into the 'req' struct
 	postBodyErr := c.BindJSON(&req)
 	if postBodyErr != nil {
-		log.Println(postBodyErr)
+		slog.WarnContext(c.Request.Context(), "invalid request body", "err", postBodyErr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": postBodyErr.Error()})
 		return
 	}
@@ -97,7 +113,11 @@ func VerifyOtp(c *gin.Context) {
 	}
 
 	// Fetch the OTP record associated with the given email
-	resp := database.Mgr.GetSingleRecordByEmail(req.Email, constant.VerificationsCollection)
+	resp, err := database.Mgr.GetSingleRecordByEmail(c.Request.Context(), req.Email, constant.VerificationsCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 
 	// Check if the email has already been verified
 	if resp.Status {
@@ -119,9 +139,9 @@ func VerifyOtp(c *gin.Context) {
 	// Update the verification record to mark the email as verified
 	req.Status = true
 	req.CreatedAt = time.Now().Unix()
-	err := database.Mgr.UpdateEmailVerifiedStatus(req, constant.VerificationsCollection)
+	err = database.Mgr.UpdateEmailVerifiedStatus(c.Request.Context(), req, constant.VerificationsCollection)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.OtpValidationError})
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": constant.OtpValidationError})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Email verified successfully"})
@@ -135,28 +155,39 @@ func RegisterUser(c *gin.Context) {
 	// Parse and bind the incoming JSON payload into the 'userClient' struct
 	regErr := c.BindJSON(&userClient)
 	if regErr != nil {
-		log.Println(regErr)
+		slog.WarnContext(c.Request.Context(), "invalid request body", "err", regErr)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": regErr.Error()})
 		return
 	}
 
 	// Validate the user input fields
 	err := helper.CheckUserValidation(userClient)
+	if err == nil {
+		err = password.Mgr.Validate(userClient.Password)
+	}
 	if err != nil {
-		log.Println(err)
+		slog.WarnContext(c.Request.Context(), "invalid registration", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
 	// Check if the email is verified in the verification records
-	verificationResp := database.Mgr.GetSingleRecordByEmail(userClient.Email, constant.VerificationsCollection)
+	verificationResp, err := database.Mgr.GetSingleRecordByEmail(c.Request.Context(), userClient.Email, constant.VerificationsCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 	if !verificationResp.Status {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailIsNotVerified})
 		return
 	}
 
 	// Ensure that the email is not already registered with another user
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(userClient.Email, constant.UserCollection)
+	userResp, err := database.Mgr.GetSingleRecordByEmailForUser(c.Request.Context(), userClient.Email, constant.UserCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 	if userResp.Email != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AlreadyRegisterWithThisEmail})
 		return
@@ -167,34 +198,43 @@ func RegisterUser(c *gin.Context) {
 	dbUser.Name = userClient.Name
 	dbUser.Phone = userClient.Phone
 	dbUser.UserType = constant.NormalUser
-	dbUser.Password = helper.GenPassHash(userClient.Password) // Hash the user's password
+	dbUser.Password, err = password.Mgr.Hash(userClient.Password)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "hashing password", "err", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": true, "message": http.StatusText(http.StatusInternalServerError)})
+		return
+	}
 	dbUser.CreatedAt = time.Now().Unix()
 	dbUser.UpdatedAt = time.Now().Unix()
 
 	// Insert the new user record into the database
-	InsertedID, err := database.Mgr.Insert(dbUser, constant.UserCollection)
+	InsertedID, err := database.Mgr.Insert(c.Request.Context(), dbUser, constant.UserCollection)
+	if mongo.IsDuplicateKeyError(err) {
+		// lost a race with a concurrent registration for the same email
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AlreadyRegisterWithThisEmail})
+		return
+	}
 	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "inserting user", "err", err)
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
 	// Generate a JWT token for the newly registered user
-	jwtWrapper := auth.JwtWrapper{
-		SecretKey:      os.Getenv("JwtSecrets"),
-		Issuer:         os.Getenv("JwtIssuer"),
-		ExpirationTime: 48, // Token expiration time in hours
-	}
+	jwtWrapper := auth.NewJwtWrapper(config.FromContext(c).Auth)
 	userID := InsertedID.(primitive.ObjectID)
-	token, err := jwtWrapper.GenrateToken(userID, userClient.Email, constant.NormalUser)
+	token, err := jwtWrapper.GenrateToken(userID, userClient.Email, constant.NormalUser, false)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(c.Request.Context(), "generating token", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
+	metrics.Registrations.Inc()
+
 	// Send a success response with the user data and token
-	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Registration successful", "data": dbUser, "token": token})
+	dbUser.Id = userID
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Registration successful", "data": types.NewUserProfile(dbUser), "token": token})
 }
 
 // UserLogin authenticates a user and generates a JWT token
@@ -204,100 +244,163 @@ func UserLogin(c *gin.Context) {
 	// Parse and bind the incoming JSON payload into the 'loginReq' struct
 	err := c.BindJSON(&loginReq)
 	if err != nil {
-		log.Panicln(err)
+		slog.WarnContext(c.Request.Context(), "invalid request body", "err", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
 	// Fetch the user record from the database using the email
-	userResp := database.Mgr.GetSingleRecordByEmailForUser(loginReq.Email, constant.UserCollection)
+	userResp, err := database.Mgr.GetSingleRecordByEmailForUser(c.Request.Context(), loginReq.Email, constant.UserCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 	if userResp.Email == "" {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotRegisteredUser})
 		return
 	}
 
-	// Validate the user's password using bcrypt
-	if err := bcrypt.CompareHashAndPassword([]byte(userResp.Password), []byte(loginReq.Password)); err != nil {
+	// Validate the user's password against the stored hash
+	matched, rehash, err := password.Mgr.Verify(userResp.Password, loginReq.Password)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "verifying password", "err", err, "user_id", userResp.Id.Hex())
+	}
+	if !matched {
+		metrics.Logins.WithLabelValues("failure").Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.PasswordNotMatchedError})
 		return
 	}
+	if rehash {
+		upgradePasswordHash(c, *userResp, loginReq.Password)
+	}
 
 	// Generate a JWT token for the authenticated user
-	jwtWrapper := auth.JwtWrapper{
-		SecretKey:      os.Getenv("JwtSecrets"),
-		Issuer:         os.Getenv("JwtIssuer"),
-		ExpirationTime: 48, // Token expiration time in hours
-	}
-	token, err := jwtWrapper.GenrateToken(userResp.Id, userResp.Email, userResp.UserType)
+	jwtWrapper := auth.NewJwtWrapper(config.FromContext(c).Auth)
+	token, err := jwtWrapper.GenrateToken(userResp.Id, userResp.Email, userResp.UserType, userResp.PasswordChangeRequired)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
-	// Send a success response with the generated token
-	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Login successful", "token": token})
-}
+	metrics.Logins.WithLabelValues("success").Inc()
 
-func AddToCart(c *gin.Context) {
-	email, ok := c.Get("email")
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotAuthorizedUserError})
+	if userResp.PasswordChangeRequired {
+		c.JSON(http.StatusOK, gin.H{"error": false, "message": "Password change required", "token": token, "password_change_required": true})
 		return
 	}
 
-	userDBResp := database.Mgr.GetSingleRecordByEmail(email.(string), constant.UserCollection)
+	// Send a success response with the generated token
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Login successful", "token": token})
+}
 
-	if userDBResp.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotRegisteredUser})
-		return
+// upgradePasswordHash replaces u's stored hash with one made under the current
+// policy. Login goes ahead if it fails; the upgrade is retried next time.
+func upgradePasswordHash(c *gin.Context, u types.User, plain string) {
+	hash, err := password.Mgr.Hash(plain)
+	if err == nil {
+		err = database.Mgr.UpdateUser(c.Request.Context(), u.Id, types.UserChanges{Password: &hash}, constant.UserCollection)
 	}
-
-	address, err := database.Mgr.GetSingleAddress(userDBResp.ID, constant.AddressCollection)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		slog.WarnContext(c.Request.Context(), "upgrading password hash", "err", err)
 		return
 	}
+	slog.InfoContext(c.Request.Context(), "upgraded password hash")
+}
 
-	if address.Address1 == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AddressNotExists})
+func AddToCart(c *gin.Context) {
+	principal := auth.MustPrincipal(c)
+
+	if !hasShippingAddress(c, principal.ID) {
 		return
 	}
 	var cart types.CartClient
 	var cartDb types.Cart
-	err = c.BindJSON(&cart)
+	err := c.BindJSON(&cart)
 
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
-	productId, _ := primitive.ObjectIDFromHex(cart.ProductID)
+	productId, err := primitive.ObjectIDFromHex(cart.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
 	// userId, _ := primitive.ObjectIDFromHex(cart.UserId)
+	if !inStock(c, productId, cart.SKU) {
+		return
+	}
 
 	cartDb.ProductID = productId
-	cartDb.UserId = userDBResp.ID
+	cartDb.SKU = cart.SKU
+	cartDb.UserId = principal.ID
 
-	_, err = database.Mgr.Insert(cartDb, constant.CartCollection)
+	_, err = database.Mgr.Insert(c.Request.Context(), cartDb, constant.CartCollection)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": err.Error()})
 		return
 	}
+	metrics.CartsCreated.Inc()
 	c.JSON(http.StatusOK, gin.H{"error": false, "message": "successful"})
 }
 
-func AddAddressOfUser(c *gin.Context) {
-	email, ok := c.Get("email")
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotAuthorizedUserError})
-		return
+// hasShippingAddress reports whether the user has an address to ship a cart
+// to. If not it responds with 400 and returns false.
+func hasShippingAddress(c *gin.Context, userId primitive.ObjectID) bool {
+	address, err := database.Mgr.GetSingleAddress(c.Request.Context(), userId, constant.AddressCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": err.Error()})
+		return false
 	}
 
-	userDBResp := database.Mgr.GetSingleRecordByEmail(email.(string), constant.UserCollection)
-	if userDBResp.Email == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotRegisteredUser})
-		return
+	if address.Address1 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AddressNotExists})
+		return false
 	}
+	return true
+}
 
+// inStock reports whether the product can go in a cart as the variant named by
+// sku: products with variants need the SKU of one with stock left, products
+// without take none. If not it responds and returns false. Stock is only
+// taken at checkout, so a line may still run out before then.
+func inStock(c *gin.Context, productId primitive.ObjectID, sku string) bool {
+	product, err := database.Mgr.GetSingleProductById(c.Request.Context(), productId, constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NoProductAvaliable})
+		return false
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return false
+	}
+
+	if len(product.Variants) == 0 {
+		if sku != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.ProductHasNoVariants})
+			return false
+		}
+		return true
+	}
+	if sku == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.VariantRequired})
+		return false
+	}
+	variant, ok := product.Variant(sku)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.VariantNotExists})
+		return false
+	}
+	if variant.Stock <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.VariantOutOfStock})
+		return false
+	}
+	return true
+}
+
+func AddAddressOfUser(c *gin.Context) {
 	var addressReq types.AddressClient
 	err := c.BindJSON(&addressReq)
 	if err != nil {
@@ -314,13 +417,13 @@ func AddAddressOfUser(c *gin.Context) {
 	var addressDB types.Address
 
 	addressDB.Address1 = addressReq.Address1
-	addressDB.UserId = userDBResp.ID
+	addressDB.UserId = auth.MustPrincipal(c).ID
 	addressDB.City = addressReq.City
 	addressDB.Country = addressReq.Country
 
-	_, err = database.Mgr.Insert(addressDB, constant.AddressCollection)
+	_, err = database.Mgr.Insert(c.Request.Context(), addressDB, constant.AddressCollection)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": err.Error()})
 		return
 	}
 
@@ -333,19 +436,34 @@ func GetSingleUser(c *gin.Context) {
 	userId, err := primitive.ObjectIDFromHex(userIdStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !auth.AuthorizeOwner(c, userId, auth.ActionReadUser) {
+		return
 	}
 
-	user, _ := database.Mgr.GetSingleUserByUserId(userId, constant.UserCollection)
+	user, err := database.Mgr.GetSingleUserByUserId(c.Request.Context(), userId, constant.UserCollection)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 
 	if user.Email == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NotRegisteredUser})
 		return
 	}
 
-	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": "success", "error": false, "data": userView(c, user)})
 
-	c.JSON(http.StatusOK, gin.H{"message": "success", "error": true, "data": user})
+}
 
+// userView selects the view of u the authenticated caller may see. Callers
+// have already passed auth.AuthorizeOwner, so the caller is either u or an admin.
+func userView(c *gin.Context, u types.User) interface{} {
+	if auth.MustPrincipal(c).IsAdmin() {
+		return types.NewAdminUserView(u)
+	}
+	return types.NewUserProfile(u)
 }
 
 func UpdateUser(c *gin.Context) {
@@ -355,13 +473,29 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
+	// the v1 route names the user in the path; the legacy one in the body
+	if id := c.Param("id"); id != "" {
+		userUpdate.Id = id
+	}
 	userId, err := primitive.ObjectIDFromHex(userUpdate.Id)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
 		return
 	}
+	if !auth.AuthorizeOwner(c, userId, auth.ActionUpdateUser) {
+		return
+	}
+	// a restricted token is only good for setting a new password
+	if auth.MustPrincipal(c).PasswordChangeRequired && userUpdate.Password == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": true, "message": constant.PasswordChangeRequiredError})
+		return
+	}
 
-	userResp, _ := database.Mgr.GetSingleUserByUserId(userId, constant.UserCollection)
+	userResp, err := database.Mgr.GetSingleUserByUserId(c.Request.Context(), userId, constant.UserCollection)
+	if err != nil && err != mongo.ErrNoDocuments {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
 
 	if userResp.Email == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.UserDoesNotExists})
@@ -378,30 +512,195 @@ func UpdateUser(c *gin.Context) {
 	user.UserType = userResp.UserType
 	user.UpdatedAt = time.Now().Unix()
 	user.CreatedAt = userResp.CreatedAt
+	user.PasswordChangeRequired = userResp.PasswordChangeRequired
+	// only what the request changes is written, so a concurrent email change
+	// or role change isn't undone
+	changes := types.UserChanges{UpdatedAt: user.UpdatedAt}
 
-	if userUpdate.Email != "" {
-		user.Email = userUpdate.Email
+	// a new address has to be confirmed first; see RequestEmailChange
+	if userUpdate.Email != "" && userUpdate.Email != user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailChangeNeedsVerification})
+		return
 	}
 
 	if userUpdate.Password != "" {
-		user.Password = userUpdate.Password
+		if err := password.Mgr.Validate(userUpdate.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+			return
+		}
+		if same, _, _ := password.Mgr.Verify(userResp.Password, userUpdate.Password); same && userResp.PasswordChangeRequired {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.SamePasswordError})
+			return
+		}
+		if user.Password, err = password.Mgr.Hash(userUpdate.Password); err != nil {
+			slog.ErrorContext(c.Request.Context(), "hashing password", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": true, "message": http.StatusText(http.StatusInternalServerError)})
+			return
+		}
+		user.PasswordChangeRequired = false
+		changes.Password, changes.PasswordChangeRequired = &user.Password, &user.PasswordChangeRequired
 	}
 
 	if userUpdate.Phone != "" {
 		user.Phone = userUpdate.Phone
+		changes.Phone = &user.Phone
 	}
 
 	if userUpdate.Name != "" {
 		user.Name = userUpdate.Name
+		changes.Name = &user.Name
 	}
 
-	err = database.Mgr.UpdateUser(user, constant.UserCollection)
+	err = database.Mgr.UpdateUser(c.Request.Context(), user.Id, changes, constant.UserCollection)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.UserDoesNotExists})
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": constant.UserDoesNotExists})
+		return
+	}
+	auth.Forget(user.Id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "error": false, "data": userView(c, user)})
+}
+
+// RequestEmailChange starts changing a user's email: it sends an OTP to the new
+// address and records it as pending. The email itself only changes once
+// ConfirmEmailChange gets the OTP back. Only the user may change their own
+// email; admins can't, since confirming hands out a token for the account.
+func RequestEmailChange(c *gin.Context) {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !auth.AuthorizeSelf(c, userId, auth.ActionChangeEmail) {
+		return
+	}
+
+	var req types.EmailChangeClient
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailValidationError})
+		return
+	}
+
+	user, err := database.Mgr.GetSingleUserByUserId(c.Request.Context(), userId, constant.UserCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.UserDoesNotExists})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if req.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.SameEmailError})
+		return
+	}
+	if p := user.PendingEmail; p != nil && p.Email == req.Email && p.SentAt+constant.OtpValidation >= time.Now().Unix() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.OptAlreadySentError})
+		return
+	}
+
+	taken, err := database.Mgr.GetSingleRecordByEmailForUser(c.Request.Context(), req.Email, constant.UserCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if taken.Email != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AlreadyRegisterWithThisEmail})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "success", "error": true, "data": user})
+	sent, err := helper.Mailer.SendOtp(c.Request.Context(), types.Verification{Email: req.Email})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "sending otp", "err", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.EmailValidationError})
+		return
+	}
+	pending := types.PendingEmail{Email: req.Email, Otp: sent.Otp, SentAt: time.Now().Unix()}
+	if err := database.Mgr.SetPendingEmail(c.Request.Context(), userId, pending, constant.UserCollection); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	metrics.OtpsSent.Inc()
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "OTP sent to the new email"})
 }
 
+// ConfirmEmailChange checks the OTP sent by RequestEmailChange, swaps the
+// pending email in and notifies the old address. The response carries a token
+// for the new address.
+func ConfirmEmailChange(c *gin.Context) {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !auth.AuthorizeSelf(c, userId, auth.ActionChangeEmail) {
+		return
+	}
+
+	var req types.EmailChangeConfirmClient
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	user, err := database.Mgr.GetSingleUserByUserId(c.Request.Context(), userId, constant.UserCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.UserDoesNotExists})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	pending := user.PendingEmail
+	if pending == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.NoPendingEmailChange})
+		return
+	}
+	if req.Otp <= 0 || req.Otp != pending.Otp {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.OtpValidationError})
+		return
+	}
+	if pending.SentAt+constant.OtpValidation < time.Now().Unix() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.OtpExpiredValidationError})
+		return
+	}
+
+	oldEmail := user.Email
+	now := time.Now().Unix()
+	err = database.Mgr.ConfirmEmailChange(c.Request.Context(), userId, oldEmail, pending.Email, now, constant.UserCollection)
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.AlreadyRegisterWithThisEmail})
+		return
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// another request changed the email or the pending address in between
+		c.JSON(http.StatusConflict, gin.H{"error": true, "message": constant.NoPendingEmailChange})
+		return
+	case err != nil:
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	auth.Forget(userId)
+	slog.InfoContext(c.Request.Context(), "email changed", "user_id", userId.Hex())
+
+	if err := helper.Mailer.NotifyEmailChanged(c.Request.Context(), oldEmail, pending.Email); err != nil {
+		slog.WarnContext(c.Request.Context(), "notifying old email address", "err", err)
+	}
+
+	user.Email = pending.Email
+	user.PendingEmail = nil
+	user.UpdatedAt = now
+	jwtWrapper := auth.NewJwtWrapper(config.FromContext(c).Auth)
+	token, err := jwtWrapper.GenrateToken(user.Id, user.Email, user.UserType, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "Email changed", "data": types.NewUserProfile(user), "token": token})
+}
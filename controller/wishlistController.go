@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"ecommerce-project/auth"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/metrics"
+	"ecommerce-project/types"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ListWishlists lists the caller's wishlists.
+func ListWishlists(c *gin.Context) {
+	wishlists, err := database.Mgr.GetWishlistsForUser(c.Request.Context(), auth.MustPrincipal(c).ID, constant.WishlistCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if wishlists == nil {
+		wishlists = []types.Wishlist{}
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": wishlists})
+}
+
+// CreateWishlist creates an empty wishlist for the caller. Names are unique per user.
+func CreateWishlist(c *gin.Context) {
+	var req types.WishlistClient
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > constant.MaxWishlistNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.WishlistNameError})
+		return
+	}
+
+	principal := auth.MustPrincipal(c)
+	existing, err := database.Mgr.GetWishlistsForUser(c.Request.Context(), principal.ID, constant.WishlistCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if len(existing) >= constant.MaxWishlists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.TooManyWishlists})
+		return
+	}
+	for _, w := range existing {
+		if w.Name == name {
+			c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.WishlistNameTaken})
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+	wishlist := types.Wishlist{
+		UserId:     principal.ID,
+		Name:       name,
+		ProductIDs: []primitive.ObjectID{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	id, err := database.Mgr.Insert(c.Request.Context(), wishlist, constant.WishlistCollection)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.WishlistNameTaken})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	wishlist.Id = id.(primitive.ObjectID)
+
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": types.WishlistDetail{Wishlist: wishlist, Products: []types.Product{}}})
+}
+
+// GetWishlist returns the wishlist named by the id path parameter with its products.
+func GetWishlist(c *gin.Context) {
+	wishlist, ok := callerWishlist(c, auth.ActionReadWishlist)
+	if !ok {
+		return
+	}
+	respondWishlist(c, wishlist)
+}
+
+// DeleteWishlist deletes the wishlist named by the id path parameter.
+func DeleteWishlist(c *gin.Context) {
+	wishlist, ok := callerWishlist(c, auth.ActionUpdateWishlist)
+	if !ok {
+		return
+	}
+	if err := database.Mgr.DeleteWishlist(c.Request.Context(), wishlist.Id, constant.WishlistCollection); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
+}
+
+// AddWishlistItem saves a product to the wishlist named by the id path
+// parameter. Saving a product that is already there changes nothing.
+func AddWishlistItem(c *gin.Context) {
+	wishlist, ok := callerWishlist(c, auth.ActionUpdateWishlist)
+	if !ok {
+		return
+	}
+
+	var req types.WishlistItemClient
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	productId, err := primitive.ObjectIDFromHex(req.ProductID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	_, err = database.Mgr.GetSingleProductById(c.Request.Context(), productId, constant.ProductCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NoProductAvaliable})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if len(wishlist.ProductIDs) >= constant.MaxWishlistItems && !slices.Contains(wishlist.ProductIDs, productId) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": constant.WishlistFull})
+		return
+	}
+
+	if !updateWishlist(c, wishlist.Id, productId, database.Mgr.AddToWishlist) {
+		return
+	}
+	reloadWishlist(c, wishlist.Id)
+}
+
+// RemoveWishlistItem removes the product named by the productId path
+// parameter from the wishlist named by the id path parameter.
+func RemoveWishlistItem(c *gin.Context) {
+	wishlist, productId, ok := callerWishlistItem(c)
+	if !ok {
+		return
+	}
+	if !updateWishlist(c, wishlist.Id, productId, database.Mgr.RemoveFromWishlist) {
+		return
+	}
+	reloadWishlist(c, wishlist.Id)
+}
+
+// MoveWishlistItemToCart adds a saved product to the caller's cart and removes
+// it from the wishlist. Like AddToCart it needs a shipping address, and for a
+// product with variants the body names one by SKU.
+func MoveWishlistItemToCart(c *gin.Context) {
+	wishlist, productId, ok := callerWishlistItem(c)
+	if !ok {
+		return
+	}
+	if !hasShippingAddress(c, wishlist.UserId) {
+		return
+	}
+
+	var req types.MoveToCartClient
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	if !inStock(c, productId, req.SKU) {
+		return
+	}
+
+	cart := types.Cart{UserId: wishlist.UserId, ProductID: productId, SKU: req.SKU}
+	if _, err := database.Mgr.Insert(c.Request.Context(), cart, constant.CartCollection); err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	metrics.CartsCreated.Inc()
+
+	if !updateWishlist(c, wishlist.Id, productId, database.Mgr.RemoveFromWishlist) {
+		return
+	}
+	reloadWishlist(c, wishlist.Id)
+}
+
+// ShareWishlist makes the wishlist named by the id path parameter readable by
+// anyone with its share link. Sharing an already shared list returns the same link.
+func ShareWishlist(c *gin.Context) {
+	wishlist, ok := callerWishlist(c, auth.ActionUpdateWishlist)
+	if !ok {
+		return
+	}
+
+	token := wishlist.ShareToken
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": true, "message": err.Error()})
+			return
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
+		if err := database.Mgr.SetWishlistShareToken(c.Request.Context(), wishlist.Id, token, constant.WishlistCollection); err != nil {
+			c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+			return
+		}
+	}
+
+	path := constant.APIPrefix + strings.Replace(constant.SharedWishlistRoute, ":token", token, 1)
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": types.WishlistShare{ShareToken: token, Path: path}})
+}
+
+// UnshareWishlist revokes the share link of the wishlist named by the id path parameter.
+func UnshareWishlist(c *gin.Context) {
+	wishlist, ok := callerWishlist(c, auth.ActionUpdateWishlist)
+	if !ok {
+		return
+	}
+	if err := database.Mgr.SetWishlistShareToken(c.Request.Context(), wishlist.Id, "", constant.WishlistCollection); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success"})
+}
+
+// GetSharedWishlist serves the read-only view of the wishlist shared under the
+// token path parameter. It needs no authentication.
+func GetSharedWishlist(c *gin.Context) {
+	wishlist, err := database.Mgr.GetWishlistByShareToken(c.Request.Context(), c.Param("token"), constant.WishlistCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.WishlistNotExists})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+
+	products, err := wishlistProducts(c, wishlist)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": types.SharedWishlist{Name: wishlist.Name, Products: products, UpdatedAt: wishlist.UpdatedAt}})
+}
+
+// callerWishlist loads the wishlist named by the id path parameter if the
+// caller may perform action on it. Otherwise it responds and returns false.
+func callerWishlist(c *gin.Context, action string) (types.Wishlist, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return types.Wishlist{}, false
+	}
+
+	wishlist, err := database.Mgr.GetWishlistById(c.Request.Context(), id, constant.WishlistCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.WishlistNotExists})
+		return types.Wishlist{}, false
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return types.Wishlist{}, false
+	}
+	if !auth.AuthorizeOwner(c, wishlist.UserId, action) {
+		return types.Wishlist{}, false
+	}
+	return wishlist, true
+}
+
+// callerWishlistItem is callerWishlist for routes that also name a saved
+// product in the productId path parameter.
+func callerWishlistItem(c *gin.Context) (types.Wishlist, primitive.ObjectID, bool) {
+	wishlist, ok := callerWishlist(c, auth.ActionUpdateWishlist)
+	if !ok {
+		return types.Wishlist{}, primitive.NilObjectID, false
+	}
+	productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": true, "message": err.Error()})
+		return types.Wishlist{}, primitive.NilObjectID, false
+	}
+	if !slices.Contains(wishlist.ProductIDs, productId) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.NotInWishlist})
+		return types.Wishlist{}, primitive.NilObjectID, false
+	}
+	return wishlist, productId, true
+}
+
+// updateWishlist applies an add or remove of productId to the wishlist. On
+// failure it responds and returns false.
+func updateWishlist(c *gin.Context, id, productId primitive.ObjectID, apply func(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collection string) error) bool {
+	err := apply(c.Request.Context(), id, productId, time.Now().Unix(), constant.WishlistCollection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": true, "message": constant.WishlistNotExists})
+		return false
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return false
+	}
+	return true
+}
+
+// reloadWishlist responds with the current state of a wishlist after a change.
+func reloadWishlist(c *gin.Context, id primitive.ObjectID) {
+	wishlist, err := database.Mgr.GetWishlistById(c.Request.Context(), id, constant.WishlistCollection)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	respondWishlist(c, wishlist)
+}
+
+func respondWishlist(c *gin.Context, wishlist types.Wishlist) {
+	products, err := wishlistProducts(c, wishlist)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": true, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"error": false, "message": "success", "data": types.WishlistDetail{Wishlist: wishlist, Products: products}})
+}
+
+// wishlistProducts looks up the products saved in a wishlist, in the order
+// they were saved, skipping any that have been deleted since.
+func wishlistProducts(c *gin.Context, wishlist types.Wishlist) ([]types.Product, error) {
+	products := []types.Product{}
+	if len(wishlist.ProductIDs) == 0 {
+		return products, nil
+	}
+
+	found, err := database.Mgr.GetProductsByIds(c.Request.Context(), wishlist.ProductIDs, constant.ProductCollection)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[primitive.ObjectID]types.Product, len(found))
+	for _, p := range found {
+		byId[p.Id] = p
+	}
+	for _, id := range wishlist.ProductIDs {
+		if p, ok := byId[id]; ok {
+			products = append(products, p.WithPriceRange())
+		}
+	}
+	return products, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/logging"
+	"ecommerce-project/password"
+	"ecommerce-project/types"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// errAlreadyRegistered is returned by addAdmin when the email has an account.
+var errAlreadyRegistered = errors.New("already registered")
+
+// createAdmin implements the createadmin subcommand. It adds an admin account
+// using the same configuration as the server. The password is read from a file
+// or standard input, never from flags or the environment, and must be changed
+// at the first login. The memory driver would lose the account when the
+// command exits, so it is refused; ADMIN_EMAIL does the job there.
+func createAdmin(args []string) error {
+	flags := flag.NewFlagSet("createadmin", flag.ContinueOnError)
+	email := flags.String("email", "", "admin email address (required)")
+	name := flags.String("name", "Admin", "admin display name")
+	passwordFile := flags.String("password-file", "", "read the password from this file instead of standard input")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if _, err := mail.ParseAddress(*email); err != nil {
+		return fmt.Errorf("createadmin: -email: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.Database.Driver == config.MemoryDriver {
+		return errors.New("createadmin: the memory driver keeps nothing after this command exits; set ADMIN_EMAIL and ADMIN_PASSWORD_FILE for the server instead")
+	}
+	logger, err := logging.New(os.Stderr, cfg.Log)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	if password.Mgr, err = password.New(cfg.Password); err != nil {
+		return err
+	}
+	secret, err := readPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+	if err := password.Mgr.Validate(secret); err != nil {
+		return fmt.Errorf("createadmin: %w", err)
+	}
+
+	if err := database.Connect(cfg.Database); err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		database.Close(ctx)
+	}()
+
+	ctx := context.Background()
+	if cfg.Database.AutoMigrate {
+		if err := database.Mgr.Migrate(ctx); err != nil {
+			return err
+		}
+	}
+
+	err = addAdmin(ctx, *email, *name, secret)
+	if errors.Is(err, errAlreadyRegistered) {
+		return fmt.Errorf("createadmin: %s is already registered", *email)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("admin created; the password must be changed at first login", "email", *email)
+	return nil
+}
+
+// bootstrapAdmin creates the admin named by cfg when the server starts,
+// unless cfg names none or the email is already registered. The password file
+// is only read when the account is created, so it may be removed afterwards.
+func bootstrapAdmin(ctx context.Context, cfg config.Admin) error {
+	if cfg.Email == "" {
+		return nil
+	}
+	existing, err := database.Mgr.GetSingleRecordByEmailForUser(ctx, cfg.Email, constant.UserCollection)
+	if err != nil {
+		return err
+	}
+	if existing.Email != "" {
+		return nil
+	}
+	secret, err := readPassword(cfg.PasswordFile)
+	if err != nil {
+		return err
+	}
+	if err := password.Mgr.Validate(secret); err != nil {
+		return fmt.Errorf("ADMIN_PASSWORD_FILE: %w", err)
+	}
+	err = addAdmin(ctx, cfg.Email, cfg.Name, secret)
+	if errors.Is(err, errAlreadyRegistered) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("admin created from ADMIN_EMAIL; the password must be changed at first login", "email", cfg.Email)
+	return nil
+}
+
+// addAdmin stores an admin account that must change its password at the
+// first login. It returns errAlreadyRegistered if the email has an account.
+func addAdmin(ctx context.Context, email, name, secret string) error {
+	existing, err := database.Mgr.GetSingleRecordByEmailForUser(ctx, email, constant.UserCollection)
+	if err != nil {
+		return err
+	}
+	if existing.Email != "" {
+		return errAlreadyRegistered
+	}
+	hash, err := password.Mgr.Hash(secret)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	admin := types.User{
+		Name:                   name,
+		Email:                  email,
+		Password:               hash,
+		UserType:               constant.AdminUser,
+		CreatedAt:              now,
+		UpdatedAt:              now,
+		PasswordChangeRequired: true,
+	}
+	_, err = database.Mgr.Insert(ctx, admin, constant.UserCollection)
+	return err
+}
+
+// readPassword reads the admin password from path, or else from standard
+// input, prompting twice without echo when it is a terminal.
+func readPassword(path string) (string, error) {
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading password file: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("reading password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	var entered [2]string
+	for i, prompt := range []string{"Admin password: ", "Repeat password: "} {
+		fmt.Fprint(os.Stderr, prompt)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("reading password: %w", err)
+		}
+		entered[i] = string(b)
+	}
+	if entered[0] != entered[1] {
+		return "", errors.New("createadmin: passwords don't match")
+	}
+	return entered[0], nil
+}
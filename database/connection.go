@@ -2,93 +2,300 @@ package database
 
 import (
 	"context"
-	"ecommerce-project/constant"
+	"crypto/tls"
+	"crypto/x509"
+	"ecommerce-project/config"
 	"ecommerce-project/types"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 type manager struct {
 	connection *mongo.Client
-	ctx        context.Context
-	cancel     context.CancelFunc
+	database   string
+	timeouts   Timeouts
 }
 
-var Mgr *manager
+// Timeouts bounds how long a single manager call may run on top of the caller's context.
+// A zero value leaves the call bounded only by the caller.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
 
-type Manager interface {
-	Insert(interface{}, string) (interface{}, error)
-	GetSingleRecordByEmail(string, string) *types.Verification
-	UpdateVerification(types.Verification, string) error
-	UpdateEmailVerifiedStatus(types.Verification, string) error
-	GetSingleRecordByEmailForUser(string, string) types.Verification
-	GetListProducts(int, int, int, string)([]types.Product, int64, error)
-	SearchProduct(int, int, int, string, string)([]types.Product, int64, error)
-	GetSingleProductById(primitive.ObjectID, string)(types.Product, error)
-	UpdateProduct(types.Product, string)error
-	DeleteProduct(primitive.ObjectID, string)error
-	GetSingleAddress(primitive.ObjectID, string)(types.Address, error)
-	GetSingleUserByUserId(primitive.ObjectID, string)(types.User, error)
-	UpdateUser(types.User, string) error
-	GetCartObjectById(primitive.ObjectID, string)(types.Cart, error)
-	GetCartObjectListForUser(primitive.ObjectID, string)([]types.Cart, error)
-	UpdateCartToCheckout(types.Cart, string)error
+func (t Timeouts) read(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Read)
 }
 
-// ConnectDb connects to the MongoDB database and initializes the global manager.
-func ConnectDb() {
-	uri := os.Getenv("BD_HOST")
-	if uri == "" {
-		uri = constant.MDBUri // Fall back to constant URI if not found in environment
+func (t Timeouts) write(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.Write)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, d)
+}
 
-	// Create the client options using ApplyURI
-	clientOptions := options.Client().ApplyURI(fmt.Sprintf("mongodb://%s", uri))
+// IsTimeout reports whether err means a database call ran past its deadline.
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)
+}
 
+// Mgr is the data access backend used by the handlers. It is set by
+// ConnectDb for MongoDB or ConnectMemory for the in-memory store.
+var Mgr Manager
 
+// Manager is the data access API used by the handlers. Every call takes the
+// request context so client disconnects and deadlines cancel the operation.
+type Manager interface {
+	Insert(context.Context, interface{}, string) (interface{}, error)
+	GetSingleRecordByEmail(context.Context, string, string) (*types.Verification, error)
+	UpdateVerification(context.Context, types.Verification, string) error
+	UpdateEmailVerifiedStatus(context.Context, types.Verification, string) error
+	GetSingleRecordByEmailForUser(context.Context, string, string) (*types.User, error)
+	GetListProducts(ctx context.Context, page, limit, offset int, sort, collection string)([]types.Product, int64, error)
+	SearchProduct(ctx context.Context, page, limit, offset int, search, sort, collection string)([]types.Product, int64, error)
+	GetSingleProductById(context.Context, primitive.ObjectID, string)(types.Product, error)
+	GetProductBySKU(context.Context, string, string) (types.Product, error)
+	UpdateProduct(context.Context, types.Product, string)error
+	RefreshProductRating(ctx context.Context, productID primitive.ObjectID, reviewCollection, productCollection string) error
+	AdjustVariantStock(ctx context.Context, id primitive.ObjectID, sku string, delta int64, collection string) error
+	AddProductImage(ctx context.Context, id primitive.ObjectID, image types.ProductImage, limit int, updatedAt int64, collection string) error
+	RemoveProductImage(ctx context.Context, id primitive.ObjectID, imageID string, updatedAt int64, collection string) error
+	SetProductImages(ctx context.Context, id primitive.ObjectID, images []types.ProductImage, updatedAt int64, collection string) error
+	DeleteProduct(context.Context, primitive.ObjectID, string)error
+	GetSingleAddress(context.Context, primitive.ObjectID, string)(types.Address, error)
+	GetSingleUserByUserId(context.Context, primitive.ObjectID, string)(types.User, error)
+	UpdateUser(ctx context.Context, id primitive.ObjectID, changes types.UserChanges, collection string) error
+	SetPendingEmail(context.Context, primitive.ObjectID, types.PendingEmail, string) error
+	ConfirmEmailChange(ctx context.Context, id primitive.ObjectID, oldEmail, newEmail string, updatedAt int64, collection string) error
+	GetCartObjectById(context.Context, primitive.ObjectID, string)(types.Cart, error)
+	GetCartObjectListForUser(context.Context, primitive.ObjectID, string)([]types.Cart, error)
+	UpdateCartToCheckout(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, collection string) ([]primitive.ObjectID, error)
+	MarkCartDelivered(ctx context.Context, id primitive.ObjectID, deliveredAt int64, collection string) error
+	HasDeliveredProduct(ctx context.Context, userID, productID primitive.ObjectID, collection string) (bool, error)
+	UpsertReview(context.Context, types.Review, string) (types.Review, error)
+	GetReviewsForProduct(ctx context.Context, productID primitive.ObjectID, page, limit int, collection string) ([]types.Review, int64, error)
+	SetReviewHidden(ctx context.Context, id primitive.ObjectID, hidden bool, reason string, collection string) (types.Review, error)
+	GetProductsByIds(context.Context, []primitive.ObjectID, string) ([]types.Product, error)
+	GetWishlistsForUser(context.Context, primitive.ObjectID, string) ([]types.Wishlist, error)
+	GetWishlistById(context.Context, primitive.ObjectID, string) (types.Wishlist, error)
+	GetWishlistByShareToken(context.Context, string, string) (types.Wishlist, error)
+	AddToWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collection string) error
+	RemoveFromWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collection string) error
+	SetWishlistShareToken(ctx context.Context, id primitive.ObjectID, token string, collection string) error
+	DeleteWishlist(context.Context, primitive.ObjectID, string) error
+	Migrate(context.Context) error
+	Ping(context.Context) error
+	Disconnect(context.Context) error
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Connect initializes the global manager with the backend selected by cfg.Driver.
+func Connect(cfg config.Database) error {
+	if cfg.Driver == config.MemoryDriver {
+		ConnectMemory()
+	} else if err := ConnectDb(cfg); err != nil {
+		return err
+	}
+	Mgr = Instrument(Mgr)
+	return nil
+}
 
-	client, err := mongo.Connect(ctx,clientOptions)
+// ConnectDb connects to the MongoDB database and initializes the global manager.
+// It returns an error instead of exiting so the caller decides how to shut down.
+func ConnectDb(cfg config.Database) error {
+	clientOptions, err := ClientOptions(cfg)
+	if err != nil {
+		return err
+	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout(cfg))
+	defer cancel()
 
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
 	// Test the connection by pinging the database
 	err = client.Ping(ctx, nil)
 	if err != nil {
-		log.Fatalf("Failed to ping MongoDB: %v", err)
+		_ = client.Disconnect(context.Background())
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	log.Printf("Successfully connected to the database at %s", uri)
+	slog.Info("connected to the database", "hosts", strings.Join(clientOptions.Hosts, ","))
 
 	// Initialize the global Mgr variable
 	Mgr = &manager{
 		connection: client,
-		ctx:        ctx,
-		cancel:     cancel,
+		database:   cfg.Name,
+		timeouts: Timeouts{
+			Read:  cfg.ReadTimeout,
+			Write: cfg.WriteTimeout,
+		},
+	}
+	return nil
+}
+
+// ClientOptions translates cfg into mongo client options. The URI, or mongodb://Host when
+// no URI is given, is applied first; explicitly configured options then override it.
+func ClientOptions(cfg config.Database) (*options.ClientOptions, error) {
+	uri := cfg.URI
+	if uri == "" {
+		uri = fmt.Sprintf("mongodb://%s", cfg.Host)
+	}
+
+	// Create the client options using ApplyURI
+	clientOptions := options.Client().ApplyURI(uri)
+	if err := clientOptions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB connection string: %w", err)
+	}
+
+	// every command becomes a child span of the request that issued it
+	clientOptions.SetMonitor(otelmongo.NewMonitor())
+
+	if cfg.Username != "" {
+		clientOptions.SetAuth(options.Credential{
+			Username:   cfg.Username,
+			Password:   cfg.Password,
+			AuthSource: cfg.AuthSource,
+		})
+	}
+	if cfg.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(cfg.ReplicaSet)
 	}
+
+	if cfg.TLS || cfg.TLSCAFile != "" || cfg.TLSCertKeyFile != "" {
+		tlsConfig, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	if cfg.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(cfg.MinPoolSize)
+	}
+	if cfg.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(cfg.MaxPoolSize)
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		clientOptions.SetMaxConnIdleTime(cfg.MaxConnIdleTime)
+	}
+	if cfg.ConnectTimeout > 0 {
+		clientOptions.SetConnectTimeout(cfg.ConnectTimeout)
+	}
+	if cfg.ServerSelectionTimeout > 0 {
+		clientOptions.SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	}
+
+	if cfg.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(cfg.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetReadPreference(rp)
+	}
+
+	if cfg.WriteConcern != "" || cfg.WriteConcernJournal {
+		wc := &writeconcern.WriteConcern{}
+		if cfg.WriteConcern != "" {
+			if n, err := strconv.Atoi(cfg.WriteConcern); err == nil {
+				wc.W = n
+			} else {
+				wc.W = cfg.WriteConcern
+			}
+		}
+		if cfg.WriteConcernJournal {
+			wc.Journal = &cfg.WriteConcernJournal
+		}
+		clientOptions.SetWriteConcern(wc)
+	}
+
+	return clientOptions, nil
 }
 
-// Close gracefully closes the MongoDB connection and cleans up resources
-func Close(client *mongo.Client, ctx context.Context, cancel context.CancelFunc) {
-	// Cancel the context and close the client connection
+// tlsConfig builds the TLS settings from the optional CA bundle and client certificate.
+func tlsConfig(cfg config.Database) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading DB_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertKeyFile != "" {
+		// MongoDB client certificates are a single PEM holding both the certificate and the key
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertKeyFile, cfg.TLSCertKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading DB_TLS_CERT_KEY_FILE: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// connectTimeout bounds the initial connect and ping so a wrong host fails startup promptly.
+func connectTimeout(cfg config.Database) time.Duration {
+	if cfg.ServerSelectionTimeout > 0 {
+		return cfg.ServerSelectionTimeout + time.Second
+	}
+	return 10 * time.Second
+}
+
+// Ping checks that the primary is reachable within the read timeout.
+func (mgr *manager) Ping(ctx context.Context) error {
+	ctx, cancel := mgr.timeouts.read(ctx)
 	defer cancel()
 
+	return mgr.connection.Ping(ctx, readpref.Primary())
+}
+
+// Disconnect closes the MongoDB client and its connection pool.
+func (mgr *manager) Disconnect(ctx context.Context) error {
+	return mgr.connection.Disconnect(ctx)
+}
+
+// Close gracefully closes the database connection behind Mgr.
+// ctx bounds how long in-flight operations get to finish.
+func Close(ctx context.Context) error {
+	if Mgr == nil {
+		return nil
+	}
+
 	// Disconnect from MongoDB
-	err := client.Disconnect(ctx)
+	err := Mgr.Disconnect(ctx)
 	if err != nil {
-		log.Printf("Error while disconnecting MongoDB client: %v", err)
-	} else {
-		log.Println("MongoDB connection closed successfully.")
+		slog.ErrorContext(ctx, "disconnecting database client", "err", err)
+		return err
 	}
+	slog.InfoContext(ctx, "database connection closed")
+	return nil
 }
@@ -4,35 +4,39 @@ import (
 	"context"
 	"ecommerce-project/constant"
 	"ecommerce-project/types"
-	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Insert inserts a new document into the specified MongoDB collection.
 // Parameters:
+// - ctx: The request context; the call is also bounded by the configured write timeout.
 // - data: The document to be inserted (as an interface{}).
 // - collectionName: The name of the MongoDB collection where the document will be stored.
 // Returns:
 // - InsertedID: The ID of the newly inserted document.
 // - error: Error if any issue occurs during the operation.
-func (mgr *manager) Insert(data interface{}, collectionName string) (interface{}, error) {
+func (mgr *manager) Insert(ctx context.Context, data interface{}, collectionName string) (interface{}, error) {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
 	// Retrieve the collection object from the database connection
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Insert the provided data into the collection
-	result, err := orgCollection.InsertOne(context.TODO(), data)
+	result, err := orgCollection.InsertOne(ctx, data)
 
 	// Check for errors in the insertion process
 	if err != nil {
 		return nil, err
 	}
 
-	// Log the result of the operation for debugging
-	log.Println(result)
+	slog.DebugContext(ctx, "inserted document", "collection", collectionName, "id", result.InsertedID)
 
 	// Return the ID of the inserted document
 	return result.InsertedID, nil
@@ -40,11 +44,16 @@ func (mgr *manager) Insert(data interface{}, collectionName string) (interface{}
 
 // GetSingleRecordByEmail retrieves a single document matching the provided email from a specified collection.
 // Parameters:
+// - ctx: The request context; the call is also bounded by the configured read timeout.
 // - email: The email address to filter by.
 // - collectionName: The name of the MongoDB collection to search.
 // Returns:
-// - *types.Verification: The verification record matching the email.
-func (mgr *manager) GetSingleRecordByEmail(email string, collectionName string) *types.Verification {
+// - *types.Verification: The verification record matching the email, empty if there is none.
+// - error: Error if the query fails for any reason other than no match.
+func (mgr *manager) GetSingleRecordByEmail(ctx context.Context, email string, collectionName string) (*types.Verification, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
 	// Create an empty Verification object to hold the response
 	resp := &types.Verification{}
 
@@ -52,34 +61,38 @@ func (mgr *manager) GetSingleRecordByEmail(email string, collectionName string)
 	filter := bson.D{{Key: "email", Value: email}}
 
 	// Retrieve the collection object
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Execute the query and decode the result into the response object
-	err := orgCollection.FindOne(context.TODO(), filter).Decode(&resp)
-
-	// Log any error that occurs during the query
-	fmt.Println(err)
+	err := orgCollection.FindOne(ctx, filter).Decode(&resp)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return resp, err
+	}
 
 	// Return the verification record (or an empty object if no match is found)
-	return resp
+	return resp, nil
 }
 
 // UpdateVerification updates the verification details of a user in a specified collection.
 // Parameters:
+// - ctx: The request context; the call is also bounded by the configured write timeout.
 // - data: The updated Verification object.
 // - collectionName: The name of the MongoDB collection to update.
 // Returns:
 // - error: Error if any issue occurs during the update operation.
-func (mgr *manager) UpdateVerification(data types.Verification, collectionName string) error {
+func (mgr *manager) UpdateVerification(ctx context.Context, data types.Verification, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
 	// Retrieve the collection object
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Define the filter and update criteria
 	filter := bson.D{{Key: "email", Value: data.Email}}
 	update := bson.D{{Key: "$set", Value: data}}
 
 	// Execute the update operation
-	_, err := orgCollection.UpdateOne(context.TODO(), filter, update)
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
 
 	// Return any error encountered during the operation
 	return err
@@ -87,20 +100,24 @@ func (mgr *manager) UpdateVerification(data types.Verification, collectionName s
 
 // UpdateEmailVerifiedStatus marks a user's email as verified in the database.
 // Parameters:
+// - ctx: The request context; the call is also bounded by the configured write timeout.
 // - req: The Verification object containing the updated status.
 // - collectionName: The name of the MongoDB collection to update.
 // Returns:
 // - error: Error if any issue occurs during the update operation.
-func (mgr *manager) UpdateEmailVerifiedStatus(req types.Verification, collectionName string) error {
+func (mgr *manager) UpdateEmailVerifiedStatus(ctx context.Context, req types.Verification, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
 	// Retrieve the collection object
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Define the filter and update criteria
 	filter := bson.D{{Key: "email", Value: req.Email}}
 	update := bson.D{{Key: "$set", Value: req}}
 
 	// Execute the update operation
-	_, err := orgCollection.UpdateOne(context.TODO(), filter, update)
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
 
 	// Return any error encountered during the operation
 	return err
@@ -108,56 +125,78 @@ func (mgr *manager) UpdateEmailVerifiedStatus(req types.Verification, collection
 
 // GetSingleRecordByEmailForUser retrieves a user record matching the provided email from a specified collection.
 // Parameters:
+// - ctx: The request context; the call is also bounded by the configured read timeout.
 // - email: The email address to filter by.
 // - collectionName: The name of the MongoDB collection to search.
 // Returns:
-// - *types.User: The user record matching the email.
-func (mgr *manager) GetSingleRecordByEmailForUser(email, collectionName string) *types.User {
+// - *types.User: The user record matching the email, empty if there is none.
+// - error: Error if the query fails for any reason other than no match.
+func (mgr *manager) GetSingleRecordByEmailForUser(ctx context.Context, email, collectionName string) (*types.User, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
 	// Create an empty User object to hold the response
 	resp := &types.User{}
 
 	// Retrieve the collection object
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Define the filter criteria for the query
 	filter := bson.D{{Key: "email", Value: email}}
 
 	// Execute the query and decode the result into the response object
-	_ = orgCollection.FindOne(context.TODO(), filter).Decode(&resp)
+	err := orgCollection.FindOne(ctx, filter).Decode(&resp)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return resp, err
+	}
 
 	// Return the user record (or an empty object if no match is found)
-	return resp
+	return resp, nil
+}
+
+// productSort returns the sort order for a product list sort key, nil for insertion order.
+func productSort(key string) bson.D {
+	if key == constant.SortByRating {
+		return bson.D{{Key: "rating_average", Value: -1}, {Key: "rating_count", Value: -1}, {Key: "_id", Value: 1}}
+	}
+	return nil
 }
 
-func (mgr *manager) GetListProducts(page, limit, offset int, collectionName string) ([]types.Product, int64, error) {
+func (mgr *manager) GetListProducts(ctx context.Context, page, limit, offset int, sort, collectionName string) ([]types.Product, int64, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
 	// Calculate skip value based on page and limit
 	skip := (page - 1) * limit
 	if offset > 0 {
 		skip = offset
 	}
 
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Set find options
 	findOptions := options.Find()
 	findOptions.SetSkip(int64(skip))
 	findOptions.SetLimit(int64(limit))
+	if s := productSort(sort); s != nil {
+		findOptions.SetSort(s)
+	}
 
 	// Query documents
-	cur, err := orgCollection.Find(context.TODO(), bson.M{}, findOptions)
+	cur, err := orgCollection.Find(ctx, bson.M{}, findOptions)
 	if err != nil {
 		return nil, 0, err
 	}
-	defer cur.Close(context.TODO())
+	defer cur.Close(ctx)
 
 	// Decode documents
 	var products []types.Product
-	if err := cur.All(context.TODO(), &products); err != nil {
+	if err := cur.All(ctx, &products); err != nil {
 		return nil, 0, err
 	}
 
 	// Count total documents
-	count, err := orgCollection.CountDocuments(context.TODO(), bson.M{})
+	count, err := orgCollection.CountDocuments(ctx, bson.M{})
 	if err != nil {
 		return nil, 0, err
 	}
@@ -165,19 +204,25 @@ func (mgr *manager) GetListProducts(page, limit, offset int, collectionName stri
 	return products, count, nil
 }
 
-func (mgr *manager) SearchProduct(page, limit, offset int, search, collectionName string) ([]types.Product, int64, error) {
+func (mgr *manager) SearchProduct(ctx context.Context, page, limit, offset int, search, sort, collectionName string) ([]types.Product, int64, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
 	// Calculate skip value based on page and limit
 	skip := (page - 1) * limit
 	if offset > 0 {
 		skip = offset
 	}
 
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	// Set find options
 	findOptions := options.Find()
 	findOptions.SetSkip(int64(skip))
 	findOptions.SetLimit(int64(limit))
+	if s := productSort(sort); s != nil {
+		findOptions.SetSort(s)
+	}
 
 	searchFilter := bson.M{}
 
@@ -189,20 +234,20 @@ func (mgr *manager) SearchProduct(page, limit, offset int, search, collectionNam
 	}
 
 	// Query documents
-	cur, err := orgCollection.Find(context.TODO(), searchFilter, findOptions)
+	cur, err := orgCollection.Find(ctx, searchFilter, findOptions)
 	if err != nil {
 		return nil, 0, err
 	}
-	defer cur.Close(context.TODO())
+	defer cur.Close(ctx)
 
 	// Decode documents
 	var products []types.Product
-	if err := cur.All(context.TODO(), &products); err != nil {
+	if err := cur.All(ctx, &products); err != nil {
 		return nil, 0, err
 	}
 
 	// Count total documents
-	count, err := orgCollection.CountDocuments(context.TODO(), bson.M{})
+	count, err := orgCollection.CountDocuments(ctx, bson.M{})
 	if err != nil {
 		return nil, 0, err
 	}
@@ -210,107 +255,573 @@ func (mgr *manager) SearchProduct(page, limit, offset int, search, collectionNam
 	return products, count, nil
 }
 
-func (mgr *manager) GetSingleProductById(id primitive.ObjectID, collectionName string) (types.Product, error) {
+func (mgr *manager) GetSingleProductById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Product, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
 	filter := bson.D{{Key: "_id", Value: id}}
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 
 	var product types.Product
-	err := orgCollection.FindOne(context.TODO(), filter).Decode(&product)
+	err := orgCollection.FindOne(ctx, filter).Decode(&product)
 
 	return product, err
 }
 
-func (mgr *manager) UpdateProduct(p types.Product, colllectionName string) error {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(colllectionName)
+// GetProductBySKU returns the product that has a variant with the given SKU.
+func (mgr *manager) GetProductBySKU(ctx context.Context, sku string, collectionName string) (types.Product, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	filter := bson.D{{Key: "variants.sku", Value: sku}}
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+
+	var product types.Product
+	err := orgCollection.FindOne(ctx, filter).Decode(&product)
+	return product, err
+}
+
+// productUpdate is the $set UpdateProduct applies: the fields an admin edits.
+// The gallery and the rating summary have their own calls, so a product
+// update racing with them can't undo their changes. Options and variants are
+// only set when p.Variants is non-nil, so an update that leaves them alone
+// can't write back stock a checkout has since taken.
+func productUpdate(p types.Product) bson.D {
+	update := bson.D{
+		{Key: "name", Value: p.Name},
+		{Key: "description", Value: p.Description},
+		{Key: "price", Value: p.Price},
+		{Key: "meta_info", Value: p.MetaInfo},
+		{Key: "updated_at", Value: p.UpdatedAt},
+	}
+	if p.Variants != nil {
+		update = append(update,
+			bson.E{Key: "options", Value: p.Options},
+			bson.E{Key: "variants", Value: p.Variants},
+		)
+	}
+	return update
+}
+
+func (mgr *manager) UpdateProduct(ctx context.Context, p types.Product, colllectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(colllectionName)
 	filter := bson.D{{Key: "_id", Value: p.Id}}
-	update := bson.D{{Key: "$set", Value: p}}
+	update := bson.D{{Key: "$set", Value: productUpdate(p)}}
 
-	_, err := orgCollection.UpdateOne(context.TODO(), filter, update)
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
 
 	return err
 }
 
-func (mgr *manager) DeleteProduct(id primitive.ObjectID, collectionName string) error {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+// RefreshProductRating recomputes a product's rating summary from its visible
+// reviews. The server reads the reviews and writes the summary in a single
+// aggregation, rather than the API reading one and writing the other, so a
+// review change can't slip in between and leave the summary stale.
+func (mgr *manager) RefreshProductRating(ctx context.Context, productID primitive.ObjectID, reviewCollection, productCollection string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(productCollection)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "_id", Value: productID}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: reviewCollection},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "product_id", Value: productID}, {Key: "hidden", Value: false}}}},
+			}},
+			{Key: "as", Value: "reviews"},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "rating_average", Value: bson.D{{Key: "$ifNull", Value: bson.A{bson.D{{Key: "$avg", Value: "$reviews.rating"}}, 0.0}}}},
+			{Key: "rating_count", Value: bson.D{{Key: "$size", Value: "$reviews"}}},
+		}}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: productCollection},
+			{Key: "whenMatched", Value: "merge"},
+			{Key: "whenNotMatched", Value: "discard"},
+		}}},
+	}
+	cur, err := orgCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cur.Close(ctx)
+}
+
+// AdjustVariantStock adds delta to the stock of a product's variant in one
+// atomic update. It returns mongo.ErrNoDocuments if the product has no variant
+// with that SKU, or if taking stock would leave it negative, so concurrent
+// buyers can't both take the last unit.
+func (mgr *manager) AdjustVariantStock(ctx context.Context, id primitive.ObjectID, sku string, delta int64, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	available := bson.D{{Key: "$gte", Value: max(-delta, 0)}}
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "variants", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "sku", Value: sku}, {Key: "stock", Value: available}}}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "variants.$[v].stock", Value: delta}}}}
+	arrayFilters := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+		bson.D{{Key: "v.sku", Value: sku}, {Key: "v.stock", Value: available}},
+	}})
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	res, err := orgCollection.UpdateOne(ctx, filter, update, arrayFilters)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// AddProductImage appends an image to the end of a product's gallery, unless
+// the gallery already holds limit images. It returns mongo.ErrNoDocuments if
+// the product doesn't exist or its gallery is full.
+func (mgr *manager) AddProductImage(ctx context.Context, id primitive.ObjectID, image types.ProductImage, limit int, updatedAt int64, collectionName string) error {
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "images." + strconv.Itoa(limit-1), Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	return mgr.updateImages(ctx, filter, collectionName, bson.D{
+		{Key: "$push", Value: bson.D{{Key: "images", Value: image}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+	})
+}
+
+// RemoveProductImage removes an image from a product's gallery. It returns
+// mongo.ErrNoDocuments if the product doesn't exist.
+func (mgr *manager) RemoveProductImage(ctx context.Context, id primitive.ObjectID, imageID string, updatedAt int64, collectionName string) error {
+	return mgr.updateImages(ctx, bson.D{{Key: "_id", Value: id}}, collectionName, bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "images", Value: bson.D{{Key: "id", Value: imageID}}}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+	})
+}
+
+// SetProductImages reorders a product's gallery to images, which must be the
+// images it holds now. It returns mongo.ErrNoDocuments if the product doesn't
+// exist or an image was added or removed since they were read.
+func (mgr *manager) SetProductImages(ctx context.Context, id primitive.ObjectID, images []types.ProductImage, updatedAt int64, collectionName string) error {
+	ids := make([]string, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "images", Value: bson.D{{Key: "$size", Value: len(images)}}}}
+	if len(ids) > 0 {
+		// $all with an empty list matches nothing
+		filter = append(filter, bson.E{Key: "images.id", Value: bson.D{{Key: "$all", Value: ids}}})
+	}
+	return mgr.updateImages(ctx, filter, collectionName, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "images", Value: images}, {Key: "updated_at", Value: updatedAt}}},
+	})
+}
+
+func (mgr *manager) updateImages(ctx context.Context, filter bson.D, collectionName string, update bson.D) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	res, err := orgCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (mgr *manager) DeleteProduct(ctx context.Context, id primitive.ObjectID, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	filter := bson.D{{Key: "_id", Value: id}}
 
-	_, err := orgCollection.DeleteOne(context.TODO(), filter)
+	_, err := orgCollection.DeleteOne(ctx, filter)
 	return err
 }
 
-func (mgr *manager) GetSingleAddress(id primitive.ObjectID, collectionName string) (types.Address, error) {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+func (mgr *manager) GetSingleAddress(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Address, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	filter := bson.D{{Key: "user_id", Value: id}}
 	var address types.Address
-	err := orgCollection.FindOne(context.TODO(), filter).Decode(&address)
+	err := orgCollection.FindOne(ctx, filter).Decode(&address)
 	return address, err
 }
 
-func (mgr *manager) GetSingleUserByUserId(id primitive.ObjectID, collectionName string) (types.User, error) {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+func (mgr *manager) GetSingleUserByUserId(ctx context.Context, id primitive.ObjectID, collectionName string) (types.User, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	filter := bson.D{{Key: "_id", Value: id}}
 	var user types.User
-	err := orgCollection.FindOne(context.TODO(), filter).Decode(&user)
+	err := orgCollection.FindOne(ctx, filter).Decode(&user)
 	return user, err
 }
 
-func (mgr *manager) GetCartObjectById(id primitive.ObjectID, collectionName string) (types.Cart, error) {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+func (mgr *manager) GetCartObjectById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Cart, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	filter := bson.D{{Key: "_id", Value: id}}
 	var cart types.Cart
-	err := orgCollection.FindOne(context.TODO(), filter).Decode(&cart)
+	err := orgCollection.FindOne(ctx, filter).Decode(&cart)
 	return cart, err
 }
 
-func (mgr *manager) GetCartObjectListForUser(userID primitive.ObjectID, collectionName string) ([]types.Cart, error) {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+func (mgr *manager) GetCartObjectListForUser(ctx context.Context, userID primitive.ObjectID, collectionName string) ([]types.Cart, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	// Define the filter for the user's carts
-	filter := bson.D{{Key: "userId", Value: userID}}
+	filter := bson.D{{Key: "user_id", Value: userID}}
 
 	// Find multiple documents
-	cursor, err := orgCollection.Find(context.TODO(), filter)
+	cursor, err := orgCollection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	// Decode documents
 	var cartItems []types.Cart
-	if err := cursor.All(context.TODO(), &cartItems); err != nil {
+	if err := cursor.All(ctx, &cartItems); err != nil {
 		return nil, err
 	}
 
 	return cartItems, nil
 }
 
-func (mgr *manager) UpdateUser(u types.User, collectionName string) error {
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
-	filter := bson.D{{Key: "_id", Value: u.Id}}
-	update := bson.D{{Key: "$set", Value: u}}
-	_, err := orgCollection.UpdateOne(context.TODO(), filter, update)
+// UpdateUser sets the fields named in changes on the user with the given id.
+func (mgr *manager) UpdateUser(ctx context.Context, id primitive.ObjectID, changes types.UserChanges, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: changes}}
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (mgr *manager) UpdateCartToCheckout(userID primitive.ObjectID, collectionName string) error {
-	// orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
-	// filter := bson.D{{Key: "_id", Value: c.Id}}
-	// update := bson.D{{Key: "$set", Value: c}}
-	// _, err := orgCollection.UpdateOne(context.TODO(), filter, update)
-	// return err
-	// Get the collection
-	orgCollection := mgr.connection.Database(constant.Database).Collection(collectionName)
+// SetPendingEmail records an email change awaiting confirmation, replacing any earlier one.
+func (mgr *manager) SetPendingEmail(ctx context.Context, id primitive.ObjectID, pending types.PendingEmail, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
 
-	// Define the filter to match documents with the given userId
-	filter := bson.D{{Key: "user_id", Value: userID}}
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "pending_email", Value: pending}}}}
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
+	return err
+}
 
-	// Define the update operation to set "checkout" to true
+// ConfirmEmailChange moves the user's pending email into email in one update.
+// It only applies while the user still has oldEmail and newEmail pending, and
+// returns mongo.ErrNoDocuments otherwise; the unique email index rejects the
+// change with a duplicate key error if newEmail was registered meanwhile.
+func (mgr *manager) ConfirmEmailChange(ctx context.Context, id primitive.ObjectID, oldEmail, newEmail string, updatedAt int64, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "email", Value: oldEmail},
+		{Key: "pending_email.email", Value: newEmail},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "email", Value: newEmail}, {Key: "updated_at", Value: updatedAt}}},
+		{Key: "$unset", Value: bson.D{{Key: "pending_email", Value: ""}}},
+	}
+	res, err := orgCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// UpdateCartToCheckout checks out the user's cart lines named by ids that
+// aren't checked out yet, and returns the ids it checked out. Each line is
+// claimed by its own conditional update, so when two checkouts race for a
+// line exactly one of them gets it.
+func (mgr *manager) UpdateCartToCheckout(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, collectionName string) ([]primitive.ObjectID, error) {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
 	update := bson.D{{Key: "$set", Value: bson.D{{Key: "checkout", Value: true}}}}
 
-	// Update all matching documents
-	_, err := orgCollection.UpdateMany(context.TODO(), filter, update)
+	var marked []primitive.ObjectID
+	for _, id := range ids {
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "user_id", Value: userID}, {Key: "checkout", Value: false}}
+		res, err := orgCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return marked, err
+		}
+		if res.ModifiedCount > 0 {
+			marked = append(marked, id)
+		}
+	}
+	return marked, nil
+}
+
+// MarkCartDelivered records that a checked-out cart line was delivered. It
+// returns mongo.ErrNoDocuments if there is no checked-out line with that id.
+func (mgr *manager) MarkCartDelivered(ctx context.Context, id primitive.ObjectID, deliveredAt int64, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "checkout", Value: true}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "delivered_at", Value: deliveredAt}}}}
+	res, err := orgCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// HasDeliveredProduct reports whether the user has a delivered cart line for the product.
+func (mgr *manager) HasDeliveredProduct(ctx context.Context, userID, productID primitive.ObjectID, collectionName string) (bool, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "product_id", Value: productID},
+		{Key: "checkout", Value: true},
+		{Key: "delivered_at", Value: bson.D{{Key: "$gt", Value: 0}}},
+	}
+	n, err := orgCollection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// UpsertReview creates the user's review of the product or replaces its rating
+// and text, and returns the stored review. Moderation state and CreatedAt of
+// an existing review are kept.
+func (mgr *manager) UpsertReview(ctx context.Context, r types.Review, collectionName string) (types.Review, error) {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "product_id", Value: r.ProductID}, {Key: "user_id", Value: r.UserId}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "user_name", Value: r.UserName},
+			{Key: "rating", Value: r.Rating},
+			{Key: "text", Value: r.Text},
+			{Key: "updated_at", Value: r.UpdatedAt},
+		}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "hidden", Value: false}, {Key: "created_at", Value: r.CreatedAt}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var review types.Review
+	err := orgCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&review)
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent first review won the insert; this one now updates it
+		err = orgCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&review)
+	}
+	return review, err
+}
+
+// GetReviewsForProduct returns a page of a product's visible reviews, most
+// recently updated first, and how many there are.
+func (mgr *manager) GetReviewsForProduct(ctx context.Context, productID primitive.ObjectID, page, limit int, collectionName string) ([]types.Review, int64, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "product_id", Value: productID}, {Key: "hidden", Value: false}}
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cur, err := orgCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	var reviews []types.Review
+	if err := cur.All(ctx, &reviews); err != nil {
+		return nil, 0, err
+	}
+	count, err := orgCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, count, nil
+}
+
+// SetReviewHidden hides or restores a review and returns it. It returns
+// mongo.ErrNoDocuments if there is no review with that id.
+func (mgr *manager) SetReviewHidden(ctx context.Context, id primitive.ObjectID, hidden bool, reason string, collectionName string) (types.Review, error) {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "hidden", Value: true}, {Key: "hidden_reason", Value: reason}}}}
+	if !hidden {
+		update = bson.D{
+			{Key: "$set", Value: bson.D{{Key: "hidden", Value: false}}},
+			{Key: "$unset", Value: bson.D{{Key: "hidden_reason", Value: ""}}},
+		}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var review types.Review
+	err := orgCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&review)
+	return review, err
+}
+
+// GetProductsByIds returns the products with the given ids that still exist, in no particular order.
+func (mgr *manager) GetProductsByIds(ctx context.Context, ids []primitive.ObjectID, collectionName string) ([]types.Product, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	cur, err := orgCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var products []types.Product
+	if err := cur.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetWishlistsForUser returns the user's wishlists, oldest first.
+func (mgr *manager) GetWishlistsForUser(ctx context.Context, userID primitive.ObjectID, collectionName string) ([]types.Wishlist, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "user_id", Value: userID}}
+	cur, err := orgCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var wishlists []types.Wishlist
+	if err := cur.All(ctx, &wishlists); err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+func (mgr *manager) GetWishlistById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Wishlist, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	var wishlist types.Wishlist
+	err := orgCollection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&wishlist)
+	return wishlist, err
+}
+
+func (mgr *manager) GetWishlistByShareToken(ctx context.Context, token string, collectionName string) (types.Wishlist, error) {
+	ctx, cancel := mgr.timeouts.read(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	var wishlist types.Wishlist
+	err := orgCollection.FindOne(ctx, bson.D{{Key: "share_token", Value: token}}).Decode(&wishlist)
+	return wishlist, err
+}
+
+// AddToWishlist adds a product to a wishlist unless it is already there. It
+// returns mongo.ErrNoDocuments if the wishlist doesn't exist.
+func (mgr *manager) AddToWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "product_ids", Value: productID}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+	}
+	res, err := orgCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RemoveFromWishlist removes a product from a wishlist. It returns
+// mongo.ErrNoDocuments if the wishlist doesn't exist.
+func (mgr *manager) RemoveFromWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
 
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "product_ids", Value: productID}}},
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+	}
+	res, err := orgCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
 	return nil
 }
+
+// SetWishlistShareToken sets the token a wishlist is shared under, or stops
+// sharing it when token is empty.
+func (mgr *manager) SetWishlistShareToken(ctx context.Context, id primitive.ObjectID, token string, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	filter := bson.D{{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "share_token", Value: token}}}}
+	if token == "" {
+		update = bson.D{{Key: "$unset", Value: bson.D{{Key: "share_token", Value: ""}}}}
+	}
+	_, err := orgCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (mgr *manager) DeleteWishlist(ctx context.Context, id primitive.ObjectID, collectionName string) error {
+	ctx, cancel := mgr.timeouts.write(ctx)
+	defer cancel()
+
+	orgCollection := mgr.connection.Database(mgr.database).Collection(collectionName)
+	_, err := orgCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return err
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"ecommerce-project/metrics"
+	"ecommerce-project/types"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// instrumented times every Manager call and reports it to metrics under the
+// method name and collection, so both backends are measured the same way.
+type instrumented struct {
+	next Manager
+}
+
+// Instrument wraps m so its calls are recorded as database latency metrics.
+func Instrument(m Manager) Manager {
+	if _, ok := m.(instrumented); ok {
+		return m
+	}
+	return instrumented{next: m}
+}
+
+// observe records the time since start. Call it deferred with a pointer to the
+// named error result so the outcome reflects what the method returned.
+func observe(method, collection string, start time.Time, err *error) {
+	outcome := metrics.OutcomeOK
+	switch {
+	case IsTimeout(*err):
+		outcome = metrics.OutcomeTimeout
+	case *err != nil:
+		outcome = metrics.OutcomeError
+	}
+	metrics.ObserveDB(method, collection, outcome, time.Since(start))
+}
+
+func (m instrumented) Insert(ctx context.Context, data interface{}, collection string) (id interface{}, err error) {
+	defer observe("Insert", collection, time.Now(), &err)
+	return m.next.Insert(ctx, data, collection)
+}
+
+func (m instrumented) GetSingleRecordByEmail(ctx context.Context, email, collection string) (v *types.Verification, err error) {
+	defer observe("GetSingleRecordByEmail", collection, time.Now(), &err)
+	return m.next.GetSingleRecordByEmail(ctx, email, collection)
+}
+
+func (m instrumented) UpdateVerification(ctx context.Context, v types.Verification, collection string) (err error) {
+	defer observe("UpdateVerification", collection, time.Now(), &err)
+	return m.next.UpdateVerification(ctx, v, collection)
+}
+
+func (m instrumented) UpdateEmailVerifiedStatus(ctx context.Context, v types.Verification, collection string) (err error) {
+	defer observe("UpdateEmailVerifiedStatus", collection, time.Now(), &err)
+	return m.next.UpdateEmailVerifiedStatus(ctx, v, collection)
+}
+
+func (m instrumented) GetSingleRecordByEmailForUser(ctx context.Context, email, collection string) (u *types.User, err error) {
+	defer observe("GetSingleRecordByEmailForUser", collection, time.Now(), &err)
+	return m.next.GetSingleRecordByEmailForUser(ctx, email, collection)
+}
+
+func (m instrumented) GetListProducts(ctx context.Context, page, limit, offset int, sort, collection string) (p []types.Product, n int64, err error) {
+	defer observe("GetListProducts", collection, time.Now(), &err)
+	return m.next.GetListProducts(ctx, page, limit, offset, sort, collection)
+}
+
+func (m instrumented) SearchProduct(ctx context.Context, page, limit, offset int, search, sort, collection string) (p []types.Product, n int64, err error) {
+	defer observe("SearchProduct", collection, time.Now(), &err)
+	return m.next.SearchProduct(ctx, page, limit, offset, search, sort, collection)
+}
+
+func (m instrumented) GetSingleProductById(ctx context.Context, id primitive.ObjectID, collection string) (p types.Product, err error) {
+	defer observe("GetSingleProductById", collection, time.Now(), &err)
+	return m.next.GetSingleProductById(ctx, id, collection)
+}
+
+func (m instrumented) GetProductBySKU(ctx context.Context, sku string, collection string) (p types.Product, err error) {
+	defer observe("GetProductBySKU", collection, time.Now(), &err)
+	return m.next.GetProductBySKU(ctx, sku, collection)
+}
+
+func (m instrumented) UpdateProduct(ctx context.Context, p types.Product, collection string) (err error) {
+	defer observe("UpdateProduct", collection, time.Now(), &err)
+	return m.next.UpdateProduct(ctx, p, collection)
+}
+
+func (m instrumented) RefreshProductRating(ctx context.Context, productID primitive.ObjectID, reviewCollection, productCollection string) (err error) {
+	defer observe("RefreshProductRating", productCollection, time.Now(), &err)
+	return m.next.RefreshProductRating(ctx, productID, reviewCollection, productCollection)
+}
+
+func (m instrumented) AdjustVariantStock(ctx context.Context, id primitive.ObjectID, sku string, delta int64, collection string) (err error) {
+	defer observe("AdjustVariantStock", collection, time.Now(), &err)
+	return m.next.AdjustVariantStock(ctx, id, sku, delta, collection)
+}
+
+func (m instrumented) AddProductImage(ctx context.Context, id primitive.ObjectID, image types.ProductImage, limit int, updatedAt int64, collection string) (err error) {
+	defer observe("AddProductImage", collection, time.Now(), &err)
+	return m.next.AddProductImage(ctx, id, image, limit, updatedAt, collection)
+}
+
+func (m instrumented) RemoveProductImage(ctx context.Context, id primitive.ObjectID, imageID string, updatedAt int64, collection string) (err error) {
+	defer observe("RemoveProductImage", collection, time.Now(), &err)
+	return m.next.RemoveProductImage(ctx, id, imageID, updatedAt, collection)
+}
+
+func (m instrumented) SetProductImages(ctx context.Context, id primitive.ObjectID, images []types.ProductImage, updatedAt int64, collection string) (err error) {
+	defer observe("SetProductImages", collection, time.Now(), &err)
+	return m.next.SetProductImages(ctx, id, images, updatedAt, collection)
+}
+
+func (m instrumented) DeleteProduct(ctx context.Context, id primitive.ObjectID, collection string) (err error) {
+	defer observe("DeleteProduct", collection, time.Now(), &err)
+	return m.next.DeleteProduct(ctx, id, collection)
+}
+
+func (m instrumented) GetSingleAddress(ctx context.Context, id primitive.ObjectID, collection string) (a types.Address, err error) {
+	defer observe("GetSingleAddress", collection, time.Now(), &err)
+	return m.next.GetSingleAddress(ctx, id, collection)
+}
+
+func (m instrumented) GetSingleUserByUserId(ctx context.Context, id primitive.ObjectID, collection string) (u types.User, err error) {
+	defer observe("GetSingleUserByUserId", collection, time.Now(), &err)
+	return m.next.GetSingleUserByUserId(ctx, id, collection)
+}
+
+func (m instrumented) UpdateUser(ctx context.Context, id primitive.ObjectID, changes types.UserChanges, collection string) (err error) {
+	defer observe("UpdateUser", collection, time.Now(), &err)
+	return m.next.UpdateUser(ctx, id, changes, collection)
+}
+
+func (m instrumented) SetPendingEmail(ctx context.Context, id primitive.ObjectID, pending types.PendingEmail, collection string) (err error) {
+	defer observe("SetPendingEmail", collection, time.Now(), &err)
+	return m.next.SetPendingEmail(ctx, id, pending, collection)
+}
+
+func (m instrumented) ConfirmEmailChange(ctx context.Context, id primitive.ObjectID, oldEmail, newEmail string, updatedAt int64, collection string) (err error) {
+	defer observe("ConfirmEmailChange", collection, time.Now(), &err)
+	return m.next.ConfirmEmailChange(ctx, id, oldEmail, newEmail, updatedAt, collection)
+}
+
+func (m instrumented) GetCartObjectById(ctx context.Context, id primitive.ObjectID, collection string) (cart types.Cart, err error) {
+	defer observe("GetCartObjectById", collection, time.Now(), &err)
+	return m.next.GetCartObjectById(ctx, id, collection)
+}
+
+func (m instrumented) GetCartObjectListForUser(ctx context.Context, id primitive.ObjectID, collection string) (carts []types.Cart, err error) {
+	defer observe("GetCartObjectListForUser", collection, time.Now(), &err)
+	return m.next.GetCartObjectListForUser(ctx, id, collection)
+}
+
+func (m instrumented) UpdateCartToCheckout(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, collection string) (marked []primitive.ObjectID, err error) {
+	defer observe("UpdateCartToCheckout", collection, time.Now(), &err)
+	return m.next.UpdateCartToCheckout(ctx, userID, ids, collection)
+}
+
+func (m instrumented) MarkCartDelivered(ctx context.Context, id primitive.ObjectID, deliveredAt int64, collection string) (err error) {
+	defer observe("MarkCartDelivered", collection, time.Now(), &err)
+	return m.next.MarkCartDelivered(ctx, id, deliveredAt, collection)
+}
+
+func (m instrumented) HasDeliveredProduct(ctx context.Context, userID, productID primitive.ObjectID, collection string) (ok bool, err error) {
+	defer observe("HasDeliveredProduct", collection, time.Now(), &err)
+	return m.next.HasDeliveredProduct(ctx, userID, productID, collection)
+}
+
+func (m instrumented) UpsertReview(ctx context.Context, r types.Review, collection string) (review types.Review, err error) {
+	defer observe("UpsertReview", collection, time.Now(), &err)
+	return m.next.UpsertReview(ctx, r, collection)
+}
+
+func (m instrumented) GetReviewsForProduct(ctx context.Context, productID primitive.ObjectID, page, limit int, collection string) (r []types.Review, n int64, err error) {
+	defer observe("GetReviewsForProduct", collection, time.Now(), &err)
+	return m.next.GetReviewsForProduct(ctx, productID, page, limit, collection)
+}
+
+func (m instrumented) SetReviewHidden(ctx context.Context, id primitive.ObjectID, hidden bool, reason, collection string) (r types.Review, err error) {
+	defer observe("SetReviewHidden", collection, time.Now(), &err)
+	return m.next.SetReviewHidden(ctx, id, hidden, reason, collection)
+}
+
+func (m instrumented) GetProductsByIds(ctx context.Context, ids []primitive.ObjectID, collection string) (p []types.Product, err error) {
+	defer observe("GetProductsByIds", collection, time.Now(), &err)
+	return m.next.GetProductsByIds(ctx, ids, collection)
+}
+
+func (m instrumented) GetWishlistsForUser(ctx context.Context, userID primitive.ObjectID, collection string) (w []types.Wishlist, err error) {
+	defer observe("GetWishlistsForUser", collection, time.Now(), &err)
+	return m.next.GetWishlistsForUser(ctx, userID, collection)
+}
+
+func (m instrumented) GetWishlistById(ctx context.Context, id primitive.ObjectID, collection string) (w types.Wishlist, err error) {
+	defer observe("GetWishlistById", collection, time.Now(), &err)
+	return m.next.GetWishlistById(ctx, id, collection)
+}
+
+func (m instrumented) GetWishlistByShareToken(ctx context.Context, token, collection string) (w types.Wishlist, err error) {
+	defer observe("GetWishlistByShareToken", collection, time.Now(), &err)
+	return m.next.GetWishlistByShareToken(ctx, token, collection)
+}
+
+func (m instrumented) AddToWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collection string) (err error) {
+	defer observe("AddToWishlist", collection, time.Now(), &err)
+	return m.next.AddToWishlist(ctx, id, productID, updatedAt, collection)
+}
+
+func (m instrumented) RemoveFromWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collection string) (err error) {
+	defer observe("RemoveFromWishlist", collection, time.Now(), &err)
+	return m.next.RemoveFromWishlist(ctx, id, productID, updatedAt, collection)
+}
+
+func (m instrumented) SetWishlistShareToken(ctx context.Context, id primitive.ObjectID, token, collection string) (err error) {
+	defer observe("SetWishlistShareToken", collection, time.Now(), &err)
+	return m.next.SetWishlistShareToken(ctx, id, token, collection)
+}
+
+func (m instrumented) DeleteWishlist(ctx context.Context, id primitive.ObjectID, collection string) (err error) {
+	defer observe("DeleteWishlist", collection, time.Now(), &err)
+	return m.next.DeleteWishlist(ctx, id, collection)
+}
+
+func (m instrumented) Migrate(ctx context.Context) error {
+	return m.next.Migrate(ctx)
+}
+
+func (m instrumented) Ping(ctx context.Context) (err error) {
+	defer observe("Ping", "", time.Now(), &err)
+	return m.next.Ping(ctx)
+}
+
+func (m instrumented) Disconnect(ctx context.Context) error {
+	return m.next.Disconnect(ctx)
+}
@@ -0,0 +1,966 @@
+package database
+
+import (
+	"context"
+	"ecommerce-project/constant"
+	"ecommerce-project/types"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryManager is an in-process implementation of Manager. Documents are kept
+// as BSON so field names, omitempty and _id handling match what MongoDB stores.
+type memoryManager struct {
+	mu          sync.RWMutex
+	collections map[string][]bson.D
+	// unique lists the unique indexes of each collection, set up by Migrate.
+	unique map[string][]uniqueIndex
+}
+
+// uniqueIndex is a unique index the in-memory store enforces.
+type uniqueIndex struct {
+	// fields are the indexed paths; dotted paths reach into embedded documents
+	// and arrays, as in MongoDB.
+	fields []string
+	// sparse skips documents that have none of the fields.
+	sparse bool
+}
+
+// idIndex is the unique index MongoDB keeps on _id in every collection.
+var idIndex = uniqueIndex{fields: []string{"_id"}, sparse: true}
+
+// keys returns the index entries of doc. Like a MongoDB multikey index, a path
+// that reaches into an array yields an entry for each element, and a missing
+// field is indexed as null unless the index is sparse.
+func (idx uniqueIndex) keys(doc bson.D) [][]interface{} {
+	keys := [][]interface{}{{}}
+	found := false
+	for _, field := range idx.fields {
+		values := pathValues(doc, strings.Split(field, "."))
+		if len(values) == 0 {
+			values = []interface{}{nil}
+		} else {
+			found = true
+		}
+		var next [][]interface{}
+		for _, key := range keys {
+			for _, v := range values {
+				next = append(next, append(slices.Clip(key), v))
+			}
+		}
+		keys = next
+	}
+	if idx.sparse && !found {
+		return nil
+	}
+	return keys
+}
+
+// pathValues returns the values at path in doc, descending into arrays.
+func pathValues(doc bson.D, path []string) []interface{} {
+	var values []interface{}
+	var walk func(v interface{}, path []string)
+	walk = func(v interface{}, path []string) {
+		if arr, ok := v.(primitive.A); ok {
+			for _, e := range arr {
+				walk(e, path)
+			}
+			return
+		}
+		if len(path) == 0 {
+			if v != nil {
+				values = append(values, v)
+			}
+			return
+		}
+		if d, ok := v.(bson.D); ok {
+			walk(lookup(d, path[0]), path[1:])
+		}
+	}
+	walk(doc, path)
+	return values
+}
+
+// ConnectMemory initializes the global manager with an empty in-memory store.
+// It is used for tests and local demo mode when no MongoDB is available.
+func ConnectMemory() {
+	Mgr = NewMemoryManager()
+	slog.Info("using the in-memory database backend")
+}
+
+// NewMemoryManager returns an empty in-memory Manager.
+func NewMemoryManager() Manager {
+	return &memoryManager{
+		collections: make(map[string][]bson.D),
+		unique:      make(map[string][]uniqueIndex),
+	}
+}
+
+// toDocument converts any BSON-serializable value into an ordered document.
+func toDocument(data interface{}) (bson.D, error) {
+	raw, err := bson.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// decode copies a stored document into out.
+func decode(doc bson.D, out interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// lookup returns the value stored under key, or nil if the key is absent.
+func lookup(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// matches reports whether the document has key set to value.
+func matches(doc bson.D, key string, value interface{}) bool {
+	v := lookup(doc, key)
+	return v != nil && v == value
+}
+
+// set merges the fields of update into doc, mirroring a MongoDB $set.
+func set(doc bson.D, update bson.D) bson.D {
+	for _, u := range update {
+		replaced := false
+		for i := range doc {
+			if doc[i].Key == u.Key {
+				doc[i].Value = u.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			doc = append(doc, u)
+		}
+	}
+	return doc
+}
+
+// findIndex returns the position of the first document in the collection with key set to value, or -1.
+func (mgr *memoryManager) findIndex(collectionName, key string, value interface{}) int {
+	for i, doc := range mgr.collections[collectionName] {
+		if matches(doc, key, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// duplicateKeyError mirrors the error MongoDB returns for a unique index violation.
+func duplicateKeyError(key string) error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error on " + key}}}
+}
+
+// checkUnique returns a duplicate key error if doc collides with another document
+// in the collection on _id or any unique index. skip is the position of doc itself, or -1.
+func (mgr *memoryManager) checkUnique(collectionName string, doc bson.D, skip int) error {
+	for _, idx := range append([]uniqueIndex{idIndex}, mgr.unique[collectionName]...) {
+		keys := idx.keys(doc)
+		if len(keys) == 0 {
+			continue
+		}
+		for i, other := range mgr.collections[collectionName] {
+			if i == skip {
+				continue
+			}
+			for _, key := range idx.keys(other) {
+				if slices.ContainsFunc(keys, func(k []interface{}) bool { return reflect.DeepEqual(k, key) }) {
+					return duplicateKeyError(strings.Join(idx.fields, ", "))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findOne decodes the first document with key set to value into out.
+// It returns mongo.ErrNoDocuments when nothing matches, like FindOne does.
+func (mgr *memoryManager) findOne(ctx context.Context, collectionName, key string, value interface{}, out interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	i := mgr.findIndex(collectionName, key, value)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	return decode(mgr.collections[collectionName][i], out)
+}
+
+// updateOne applies data as a $set to the first document with key set to value.
+func (mgr *memoryManager) updateOne(ctx context.Context, collectionName, key string, value interface{}, data interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	update, err := toDocument(data)
+	if err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, key, value)
+	if i < 0 {
+		return nil
+	}
+	updated := set(append(bson.D{}, mgr.collections[collectionName][i]...), update)
+	if err := mgr.checkUnique(collectionName, updated, i); err != nil {
+		return err
+	}
+	mgr.collections[collectionName][i] = updated
+	return nil
+}
+
+// window returns the bounds of a page of n documents using the same skip/limit
+// rules as the MongoDB backend.
+func window(n, page, limit, offset int) (start, end int) {
+	skip := (page - 1) * limit
+	if offset > 0 {
+		skip = offset
+	}
+	if skip < 0 {
+		skip = 0
+	}
+	if skip > n {
+		skip = n
+	}
+	end = n
+	if limit > 0 && skip+limit < end {
+		end = skip + limit
+	}
+	return skip, end
+}
+
+// number returns the numeric value stored under key as a float64, or 0.
+func number(doc bson.D, key string) float64 {
+	switch v := lookup(doc, key).(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	}
+	return 0
+}
+
+// sortProducts orders docs by a product list sort key like productSort does.
+func sortProducts(docs []bson.D, key string) []bson.D {
+	if key != constant.SortByRating {
+		return docs
+	}
+	sorted := append([]bson.D(nil), docs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if a, b := number(sorted[i], "rating_average"), number(sorted[j], "rating_average"); a != b {
+			return a > b
+		}
+		return number(sorted[i], "rating_count") > number(sorted[j], "rating_count")
+	})
+	return sorted
+}
+
+// page decodes a window of products using the same skip/limit rules as the MongoDB backend.
+func page(docs []bson.D, page, limit, offset int) ([]types.Product, error) {
+	skip, end := window(len(docs), page, limit, offset)
+
+	var products []types.Product
+	for _, doc := range docs[skip:end] {
+		var p types.Product
+		if err := decode(doc, &p); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+func (mgr *memoryManager) Insert(ctx context.Context, data interface{}, collectionName string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	doc, err := toDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id := lookup(doc, "_id")
+	if id == nil {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if err := mgr.checkUnique(collectionName, doc, -1); err != nil {
+		return nil, err
+	}
+	mgr.collections[collectionName] = append(mgr.collections[collectionName], doc)
+
+	return id, nil
+}
+
+func (mgr *memoryManager) GetSingleRecordByEmail(ctx context.Context, email string, collectionName string) (*types.Verification, error) {
+	resp := &types.Verification{}
+	if err := mgr.findOne(ctx, collectionName, "email", email, resp); err != nil && err != mongo.ErrNoDocuments {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (mgr *memoryManager) UpdateVerification(ctx context.Context, data types.Verification, collectionName string) error {
+	return mgr.updateOne(ctx, collectionName, "email", data.Email, data)
+}
+
+func (mgr *memoryManager) UpdateEmailVerifiedStatus(ctx context.Context, req types.Verification, collectionName string) error {
+	return mgr.updateOne(ctx, collectionName, "email", req.Email, req)
+}
+
+func (mgr *memoryManager) GetSingleRecordByEmailForUser(ctx context.Context, email, collectionName string) (*types.User, error) {
+	resp := &types.User{}
+	if err := mgr.findOne(ctx, collectionName, "email", email, resp); err != nil && err != mongo.ErrNoDocuments {
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (mgr *memoryManager) GetListProducts(ctx context.Context, pageNo, limit, offset int, sort, collectionName string) ([]types.Product, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	docs := mgr.collections[collectionName]
+	products, err := page(sortProducts(docs, sort), pageNo, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, int64(len(docs)), nil
+}
+
+func (mgr *memoryManager) SearchProduct(ctx context.Context, pageNo, limit, offset int, search, sort, collectionName string) ([]types.Product, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	docs := mgr.collections[collectionName]
+	filtered := docs
+
+	if len(search) >= 3 {
+		re, err := regexp.Compile("(?i).*" + search + ".*")
+		if err != nil {
+			return nil, 0, err
+		}
+		filtered = nil
+		for _, doc := range docs {
+			name, _ := lookup(doc, "name").(string)
+			description, _ := lookup(doc, "description").(string)
+			if re.MatchString(name) || re.MatchString(description) {
+				filtered = append(filtered, doc)
+			}
+		}
+	}
+
+	products, err := page(sortProducts(filtered, sort), pageNo, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, int64(len(docs)), nil
+}
+
+func (mgr *memoryManager) GetSingleProductById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Product, error) {
+	var product types.Product
+	err := mgr.findOne(ctx, collectionName, "_id", id, &product)
+	return product, err
+}
+
+func (mgr *memoryManager) GetProductBySKU(ctx context.Context, sku string, collectionName string) (types.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Product{}, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	for _, doc := range mgr.collections[collectionName] {
+		variants, _ := lookup(doc, "variants").(primitive.A)
+		for _, v := range variants {
+			if variant, ok := v.(bson.D); ok && matches(variant, "sku", sku) {
+				var product types.Product
+				err := decode(doc, &product)
+				return product, err
+			}
+		}
+	}
+	return types.Product{}, mongo.ErrNoDocuments
+}
+
+func (mgr *memoryManager) UpdateProduct(ctx context.Context, p types.Product, collectionName string) error {
+	return mgr.updateOne(ctx, collectionName, "_id", p.Id, productUpdate(p))
+}
+
+func (mgr *memoryManager) AdjustVariantStock(ctx context.Context, id primitive.ObjectID, sku string, delta int64, collectionName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	var product types.Product
+	if err := decode(mgr.collections[collectionName][i], &product); err != nil {
+		return err
+	}
+	v := slices.IndexFunc(product.Variants, func(v types.Variant) bool { return v.SKU == sku })
+	if v < 0 || product.Variants[v].Stock+delta < 0 {
+		return mongo.ErrNoDocuments
+	}
+	product.Variants[v].Stock += delta
+	update, err := toDocument(bson.D{{Key: "variants", Value: product.Variants}})
+	if err != nil {
+		return err
+	}
+	mgr.collections[collectionName][i] = set(mgr.collections[collectionName][i], update)
+	return nil
+}
+
+// updateImages rewrites the images array of a product, mirroring $push, $pull
+// and $set. edit returns false, for mongo.ErrNoDocuments, where the Mongo
+// filter wouldn't match.
+func (mgr *memoryManager) updateImages(ctx context.Context, id primitive.ObjectID, updatedAt int64, collectionName string, edit func([]types.ProductImage) ([]types.ProductImage, bool)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	var product types.Product
+	if err := decode(mgr.collections[collectionName][i], &product); err != nil {
+		return err
+	}
+	images, ok := edit(product.Images)
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	update, err := toDocument(bson.D{
+		{Key: "images", Value: images},
+		{Key: "updated_at", Value: updatedAt},
+	})
+	if err != nil {
+		return err
+	}
+	mgr.collections[collectionName][i] = set(mgr.collections[collectionName][i], update)
+	return nil
+}
+
+func (mgr *memoryManager) AddProductImage(ctx context.Context, id primitive.ObjectID, image types.ProductImage, limit int, updatedAt int64, collectionName string) error {
+	return mgr.updateImages(ctx, id, updatedAt, collectionName, func(images []types.ProductImage) ([]types.ProductImage, bool) {
+		return append(images, image), len(images) < limit
+	})
+}
+
+func (mgr *memoryManager) RemoveProductImage(ctx context.Context, id primitive.ObjectID, imageID string, updatedAt int64, collectionName string) error {
+	return mgr.updateImages(ctx, id, updatedAt, collectionName, func(images []types.ProductImage) ([]types.ProductImage, bool) {
+		kept := []types.ProductImage{}
+		for _, image := range images {
+			if image.ID != imageID {
+				kept = append(kept, image)
+			}
+		}
+		return kept, true
+	})
+}
+
+func (mgr *memoryManager) SetProductImages(ctx context.Context, id primitive.ObjectID, images []types.ProductImage, updatedAt int64, collectionName string) error {
+	return mgr.updateImages(ctx, id, updatedAt, collectionName, func(current []types.ProductImage) ([]types.ProductImage, bool) {
+		if len(current) != len(images) {
+			return nil, false
+		}
+		for _, image := range images {
+			if !slices.ContainsFunc(current, func(c types.ProductImage) bool { return c.ID == image.ID }) {
+				return nil, false
+			}
+		}
+		return images, true
+	})
+}
+
+func (mgr *memoryManager) DeleteProduct(ctx context.Context, id primitive.ObjectID, collectionName string) error {
+	return mgr.deleteById(ctx, id, collectionName)
+}
+
+// deleteById removes the document with the given _id, if there is one.
+func (mgr *memoryManager) deleteById(ctx context.Context, id primitive.ObjectID, collectionName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return nil
+	}
+	docs := mgr.collections[collectionName]
+	mgr.collections[collectionName] = append(docs[:i:i], docs[i+1:]...)
+	return nil
+}
+
+func (mgr *memoryManager) GetSingleAddress(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Address, error) {
+	var address types.Address
+	err := mgr.findOne(ctx, collectionName, "user_id", id, &address)
+	return address, err
+}
+
+func (mgr *memoryManager) GetSingleUserByUserId(ctx context.Context, id primitive.ObjectID, collectionName string) (types.User, error) {
+	var user types.User
+	err := mgr.findOne(ctx, collectionName, "_id", id, &user)
+	return user, err
+}
+
+func (mgr *memoryManager) GetCartObjectById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Cart, error) {
+	var cart types.Cart
+	err := mgr.findOne(ctx, collectionName, "_id", id, &cart)
+	return cart, err
+}
+
+func (mgr *memoryManager) GetCartObjectListForUser(ctx context.Context, userID primitive.ObjectID, collectionName string) ([]types.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	var cartItems []types.Cart
+	for _, doc := range mgr.collections[collectionName] {
+		if !matches(doc, "user_id", userID) {
+			continue
+		}
+		var cart types.Cart
+		if err := decode(doc, &cart); err != nil {
+			return nil, err
+		}
+		cartItems = append(cartItems, cart)
+	}
+	return cartItems, nil
+}
+
+func (mgr *memoryManager) UpdateUser(ctx context.Context, id primitive.ObjectID, changes types.UserChanges, collectionName string) error {
+	return mgr.updateOne(ctx, collectionName, "_id", id, changes)
+}
+
+func (mgr *memoryManager) SetPendingEmail(ctx context.Context, id primitive.ObjectID, pending types.PendingEmail, collectionName string) error {
+	return mgr.updateOne(ctx, collectionName, "_id", id, bson.M{"pending_email": pending})
+}
+
+func (mgr *memoryManager) ConfirmEmailChange(ctx context.Context, id primitive.ObjectID, oldEmail, newEmail string, updatedAt int64, collectionName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	doc := mgr.collections[collectionName][i]
+	pending, _ := lookup(doc, "pending_email").(bson.D)
+	if !matches(doc, "email", oldEmail) || !matches(pending, "email", newEmail) {
+		return mongo.ErrNoDocuments
+	}
+
+	var updated bson.D
+	for _, e := range doc {
+		if e.Key != "pending_email" {
+			updated = append(updated, e)
+		}
+	}
+	updated = set(updated, bson.D{{Key: "email", Value: newEmail}, {Key: "updated_at", Value: updatedAt}})
+	if err := mgr.checkUnique(collectionName, updated, i); err != nil {
+		return err
+	}
+	mgr.collections[collectionName][i] = updated
+	return nil
+}
+
+func (mgr *memoryManager) UpdateCartToCheckout(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, collectionName string) ([]primitive.ObjectID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	var marked []primitive.ObjectID
+	for _, id := range ids {
+		i := mgr.findIndex(collectionName, "_id", id)
+		if i < 0 {
+			continue
+		}
+		doc := mgr.collections[collectionName][i]
+		if matches(doc, "user_id", userID) && matches(doc, "checkout", false) {
+			mgr.collections[collectionName][i] = set(doc, bson.D{{Key: "checkout", Value: true}})
+			marked = append(marked, id)
+		}
+	}
+	return marked, nil
+}
+
+func (mgr *memoryManager) MarkCartDelivered(ctx context.Context, id primitive.ObjectID, deliveredAt int64, collectionName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 || !matches(mgr.collections[collectionName][i], "checkout", true) {
+		return mongo.ErrNoDocuments
+	}
+	mgr.collections[collectionName][i] = set(mgr.collections[collectionName][i], bson.D{{Key: "delivered_at", Value: deliveredAt}})
+	return nil
+}
+
+func (mgr *memoryManager) HasDeliveredProduct(ctx context.Context, userID, productID primitive.ObjectID, collectionName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	for _, doc := range mgr.collections[collectionName] {
+		if matches(doc, "user_id", userID) && matches(doc, "product_id", productID) &&
+			matches(doc, "checkout", true) && number(doc, "delivered_at") > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (mgr *memoryManager) UpsertReview(ctx context.Context, r types.Review, collectionName string) (types.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Review{}, err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	docs := mgr.collections[collectionName]
+	for i, doc := range docs {
+		if !matches(doc, "product_id", r.ProductID) || !matches(doc, "user_id", r.UserId) {
+			continue
+		}
+		updated, err := toDocument(bson.D{
+			{Key: "user_name", Value: r.UserName},
+			{Key: "rating", Value: r.Rating},
+			{Key: "text", Value: r.Text},
+			{Key: "updated_at", Value: r.UpdatedAt},
+		})
+		if err != nil {
+			return types.Review{}, err
+		}
+		docs[i] = set(doc, updated)
+		var review types.Review
+		err = decode(docs[i], &review)
+		return review, err
+	}
+
+	r.Id = primitive.NewObjectID()
+	r.Hidden = false
+	r.HiddenReason = ""
+	doc, err := toDocument(r)
+	if err != nil {
+		return types.Review{}, err
+	}
+	mgr.collections[collectionName] = append(docs, doc)
+	return r, nil
+}
+
+func (mgr *memoryManager) GetReviewsForProduct(ctx context.Context, productID primitive.ObjectID, pageNo, limit int, collectionName string) ([]types.Review, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	var visible []bson.D
+	for _, doc := range mgr.collections[collectionName] {
+		if matches(doc, "product_id", productID) && matches(doc, "hidden", false) {
+			visible = append(visible, doc)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		if a, b := number(visible[i], "updated_at"), number(visible[j], "updated_at"); a != b {
+			return a > b
+		}
+		a, _ := lookup(visible[i], "_id").(primitive.ObjectID)
+		b, _ := lookup(visible[j], "_id").(primitive.ObjectID)
+		return a.Hex() > b.Hex()
+	})
+
+	start, end := window(len(visible), pageNo, limit, 0)
+	var reviews []types.Review
+	for _, doc := range visible[start:end] {
+		var r types.Review
+		if err := decode(doc, &r); err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, int64(len(visible)), nil
+}
+
+func (mgr *memoryManager) SetReviewHidden(ctx context.Context, id primitive.ObjectID, hidden bool, reason string, collectionName string) (types.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return types.Review{}, err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return types.Review{}, mongo.ErrNoDocuments
+	}
+	var updated bson.D
+	for _, e := range mgr.collections[collectionName][i] {
+		if e.Key != "hidden_reason" {
+			updated = append(updated, e)
+		}
+	}
+	updated = set(updated, bson.D{{Key: "hidden", Value: hidden}})
+	if hidden {
+		updated = set(updated, bson.D{{Key: "hidden_reason", Value: reason}})
+	}
+	mgr.collections[collectionName][i] = updated
+
+	var review types.Review
+	err := decode(updated, &review)
+	return review, err
+}
+
+// RefreshProductRating holds the lock while it reads the reviews and writes
+// the summary, so it is as atomic as the MongoDB aggregation.
+func (mgr *memoryManager) RefreshProductRating(ctx context.Context, productID primitive.ObjectID, reviewCollection, productCollection string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	var count int64
+	var total, average float64
+	for _, doc := range mgr.collections[reviewCollection] {
+		if matches(doc, "product_id", productID) && matches(doc, "hidden", false) {
+			total += number(doc, "rating")
+			count++
+		}
+	}
+	if count > 0 {
+		average = total / float64(count)
+	}
+
+	i := mgr.findIndex(productCollection, "_id", productID)
+	if i < 0 {
+		return nil
+	}
+	mgr.collections[productCollection][i] = set(mgr.collections[productCollection][i], bson.D{
+		{Key: "rating_average", Value: average},
+		{Key: "rating_count", Value: count},
+	})
+	return nil
+}
+
+func (mgr *memoryManager) GetProductsByIds(ctx context.Context, ids []primitive.ObjectID, collectionName string) ([]types.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	var products []types.Product
+	for _, id := range ids {
+		i := mgr.findIndex(collectionName, "_id", id)
+		if i < 0 {
+			continue
+		}
+		var p types.Product
+		if err := decode(mgr.collections[collectionName][i], &p); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, nil
+}
+
+func (mgr *memoryManager) GetWishlistsForUser(ctx context.Context, userID primitive.ObjectID, collectionName string) ([]types.Wishlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mgr.mu.RLock()
+	defer mgr.mu.RUnlock()
+
+	var wishlists []types.Wishlist
+	for _, doc := range mgr.collections[collectionName] {
+		if !matches(doc, "user_id", userID) {
+			continue
+		}
+		var w types.Wishlist
+		if err := decode(doc, &w); err != nil {
+			return nil, err
+		}
+		wishlists = append(wishlists, w)
+	}
+	return wishlists, nil
+}
+
+func (mgr *memoryManager) GetWishlistById(ctx context.Context, id primitive.ObjectID, collectionName string) (types.Wishlist, error) {
+	var wishlist types.Wishlist
+	err := mgr.findOne(ctx, collectionName, "_id", id, &wishlist)
+	return wishlist, err
+}
+
+func (mgr *memoryManager) GetWishlistByShareToken(ctx context.Context, token string, collectionName string) (types.Wishlist, error) {
+	var wishlist types.Wishlist
+	err := mgr.findOne(ctx, collectionName, "share_token", token, &wishlist)
+	return wishlist, err
+}
+
+// updateProductIds rewrites the product_ids array of a wishlist, mirroring $addToSet and $pull.
+func (mgr *memoryManager) updateProductIds(ctx context.Context, id primitive.ObjectID, updatedAt int64, collectionName string, edit func(primitive.A) primitive.A) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return mongo.ErrNoDocuments
+	}
+	doc := mgr.collections[collectionName][i]
+	ids, _ := lookup(doc, "product_ids").(primitive.A)
+	mgr.collections[collectionName][i] = set(doc, bson.D{
+		{Key: "product_ids", Value: edit(append(primitive.A{}, ids...))},
+		{Key: "updated_at", Value: updatedAt},
+	})
+	return nil
+}
+
+func (mgr *memoryManager) AddToWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collectionName string) error {
+	return mgr.updateProductIds(ctx, id, updatedAt, collectionName, func(ids primitive.A) primitive.A {
+		for _, v := range ids {
+			if v == productID {
+				return ids
+			}
+		}
+		return append(ids, productID)
+	})
+}
+
+func (mgr *memoryManager) RemoveFromWishlist(ctx context.Context, id, productID primitive.ObjectID, updatedAt int64, collectionName string) error {
+	return mgr.updateProductIds(ctx, id, updatedAt, collectionName, func(ids primitive.A) primitive.A {
+		kept := primitive.A{}
+		for _, v := range ids {
+			if v != productID {
+				kept = append(kept, v)
+			}
+		}
+		return kept
+	})
+}
+
+func (mgr *memoryManager) SetWishlistShareToken(ctx context.Context, id primitive.ObjectID, token string, collectionName string) error {
+	if token != "" {
+		return mgr.updateOne(ctx, collectionName, "_id", id, bson.D{{Key: "share_token", Value: token}})
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	i := mgr.findIndex(collectionName, "_id", id)
+	if i < 0 {
+		return nil
+	}
+	var updated bson.D
+	for _, e := range mgr.collections[collectionName][i] {
+		if e.Key != "share_token" {
+			updated = append(updated, e)
+		}
+	}
+	mgr.collections[collectionName][i] = updated
+	return nil
+}
+
+func (mgr *memoryManager) DeleteWishlist(ctx context.Context, id primitive.ObjectID, collectionName string) error {
+	return mgr.deleteById(ctx, id, collectionName)
+}
+
+// Ping only fails when ctx is already done; the store is always reachable.
+func (mgr *memoryManager) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Disconnect is a no-op; the in-memory store has no connection to release.
+func (mgr *memoryManager) Disconnect(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"context"
+	"ecommerce-project/constant"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationsCollection records which migrations have been applied, one document per version.
+const MigrationsCollection = "schema_migrations"
+
+// Index describes an index a migration ensures exists.
+type Index struct {
+	Collection string
+	Name       string
+	Keys       bson.D
+	Unique     bool
+	// Sparse leaves documents without the indexed field out, so a unique index
+	// only applies to documents that have it.
+	Sparse bool
+}
+
+// Migration is one versioned change to the schema or data. Migrations run in
+// version order, once per database. Both Indexes and Data must be safe to run
+// again: two instances starting together may both apply the same version.
+type Migration struct {
+	Version     int
+	Description string
+	Indexes     []Index
+	// Data runs after the indexes are created. The in-memory backend skips it.
+	Data func(ctx context.Context, db *mongo.Database) error
+}
+
+// appliedMigration is the record stored in MigrationsCollection.
+type appliedMigration struct {
+	Version     int    `bson:"_id"`
+	Description string `bson:"description"`
+	AppliedAt   int64  `bson:"applied_at"`
+}
+
+// Migrations is the ordered schema history. Append new versions; never edit applied ones.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "unique emails for users and verifications",
+		Indexes: []Index{
+			{Collection: constant.UserCollection, Name: "email_unique", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+			{Collection: constant.VerificationsCollection, Name: "email_unique", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		},
+	},
+	{
+		Version:     2,
+		Description: "user_id lookups for addresses and carts",
+		Indexes: []Index{
+			{Collection: constant.AddressCollection, Name: "user_id", Keys: bson.D{{Key: "user_id", Value: 1}}},
+			{Collection: constant.CartCollection, Name: "user_id_checkout", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "checkout", Value: 1}}},
+		},
+	},
+	{
+		Version:     3,
+		Description: "product text search and recency",
+		Indexes: []Index{
+			{Collection: constant.ProductCollection, Name: "name_description_text", Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}}},
+			{Collection: constant.ProductCollection, Name: "created_at", Keys: bson.D{{Key: "created_at", Value: -1}}},
+		},
+	},
+	{
+		Version:     4,
+		Description: "backfill user created_at/updated_at from the document id",
+		Data:        backfillUserTimestamps,
+	},
+	{
+		Version:     5,
+		Description: "one review per user and product, review listing and rating sort",
+		Indexes: []Index{
+			{Collection: constant.ReviewCollection, Name: "product_id_user_id_unique", Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "user_id", Value: 1}}, Unique: true},
+			{Collection: constant.ReviewCollection, Name: "product_id_hidden_updated_at", Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "hidden", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Collection: constant.ProductCollection, Name: "rating", Keys: bson.D{{Key: "rating_average", Value: -1}, {Key: "rating_count", Value: -1}}},
+			{Collection: constant.CartCollection, Name: "user_id_product_id", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "product_id", Value: 1}}},
+		},
+	},
+	{
+		Version:     6,
+		Description: "wishlists by user and share token",
+		Indexes: []Index{
+			{Collection: constant.WishlistCollection, Name: "user_id_name_unique", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}}, Unique: true},
+			{Collection: constant.WishlistCollection, Name: "share_token_unique", Keys: bson.D{{Key: "share_token", Value: 1}}, Unique: true, Sparse: true},
+		},
+	},
+	{
+		Version:     7,
+		Description: "variant SKUs unique across products",
+		Indexes: []Index{
+			{Collection: constant.ProductCollection, Name: "variants_sku_unique", Keys: bson.D{{Key: "variants.sku", Value: 1}}, Unique: true, Sparse: true},
+		},
+	},
+}
+
+// Migrate applies every migration in Migrations that is not yet recorded in MigrationsCollection.
+func (mgr *manager) Migrate(ctx context.Context) error {
+	db := mgr.connection.Database(mgr.database)
+	history := db.Collection(MigrationsCollection)
+
+	applied, err := appliedVersions(ctx, history)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pending(applied) {
+		slog.InfoContext(ctx, "applying migration", "version", m.Version, "description", m.Description)
+
+		if err := createIndexes(ctx, db, m.Indexes); err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if m.Data != nil {
+			if err := m.Data(ctx, db); err != nil {
+				return fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+		}
+
+		record := appliedMigration{Version: m.Version, Description: m.Description, AppliedAt: time.Now().Unix()}
+		if _, err := history.InsertOne(ctx, record); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, history *mongo.Collection) (map[int]bool, error) {
+	cur, err := history.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var records []appliedMigration
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+// pending returns the migrations not in applied, lowest version first.
+func pending(applied map[int]bool) []Migration {
+	var todo []Migration
+	for _, m := range Migrations {
+		if !applied[m.Version] {
+			todo = append(todo, m)
+		}
+	}
+	sort.Slice(todo, func(i, j int) bool { return todo[i].Version < todo[j].Version })
+	return todo
+}
+
+func createIndexes(ctx context.Context, db *mongo.Database, indexes []Index) error {
+	for _, idx := range indexes {
+		model := mongo.IndexModel{
+			Keys:    idx.Keys,
+			Options: options.Index().SetName(idx.Name).SetUnique(idx.Unique).SetSparse(idx.Sparse),
+		}
+		if _, err := db.Collection(idx.Collection).Indexes().CreateOne(ctx, model); err != nil {
+			return fmt.Errorf("creating index %s on %s: %w", idx.Name, idx.Collection, err)
+		}
+	}
+	return nil
+}
+
+// backfillUserTimestamps sets created_at and updated_at on users that never had them,
+// such as the bootstrap admin, using the creation time encoded in their ObjectID.
+func backfillUserTimestamps(ctx context.Context, db *mongo.Database) error {
+	fromId := bson.D{{Key: "$toLong", Value: bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$toLong", Value: bson.D{{Key: "$toDate", Value: "$_id"}}}}, 1000,
+	}}}}}
+
+	for _, field := range []string{"created_at", "updated_at"} {
+		filter := bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.D{{Key: field, Value: fromId}}}}}
+		if _, err := db.Collection(constant.UserCollection).UpdateMany(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate enforces the unique indexes from Migrations, compound and dotted
+// ones included, so the in-memory store rejects the same duplicates MongoDB
+// would. Data migrations don't apply to a fresh store.
+func (mgr *memoryManager) Migrate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	mgr.unique = make(map[string][]uniqueIndex)
+	for _, m := range pending(nil) {
+		for _, idx := range m.Indexes {
+			if !idx.Unique {
+				continue
+			}
+			unique := uniqueIndex{sparse: idx.Sparse}
+			for _, key := range idx.Keys {
+				unique.fields = append(unique.fields, key.Key)
+			}
+			mgr.unique[idx.Collection] = append(mgr.unique[idx.Collection], unique)
+		}
+	}
+	return nil
+}
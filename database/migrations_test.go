@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"ecommerce-project/constant"
+	"ecommerce-project/types"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestPendingSkipsAppliedInOrder(t *testing.T) {
+	todo := pending(map[int]bool{1: true, 3: true})
+
+	var versions []int
+	for _, m := range todo {
+		versions = append(versions, m.Version)
+	}
+	for i := 1; i < len(versions); i++ {
+		if versions[i] <= versions[i-1] {
+			t.Fatalf("versions = %v, want ascending", versions)
+		}
+	}
+	for _, v := range versions {
+		if v == 1 || v == 3 {
+			t.Fatalf("versions = %v, want applied ones skipped", versions)
+		}
+	}
+}
+
+func TestMemoryMigrateEnforcesUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	mgr := NewMemoryManager()
+
+	for i := 0; i < 2; i++ {
+		if err := mgr.Migrate(ctx); err != nil {
+			t.Fatalf("Migrate() run %d error = %v", i+1, err)
+		}
+	}
+
+	user := types.User{Name: "A", Email: "a@test.local"}
+	if _, err := mgr.Insert(ctx, user, constant.UserCollection); err != nil {
+		t.Fatalf("first insert error = %v", err)
+	}
+	_, err := mgr.Insert(ctx, user, constant.UserCollection)
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Fatalf("second insert error = %v, want a duplicate key error", err)
+	}
+}
+
+func TestMemoryMigrateEnforcesCompoundAndNestedKeys(t *testing.T) {
+	ctx := context.Background()
+	mgr := NewMemoryManager()
+	if err := mgr.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	// user_id and name are unique together, not apart
+	owner, other := primitive.NewObjectID(), primitive.NewObjectID()
+	for _, w := range []types.Wishlist{{UserId: owner, Name: "Gifts"}, {UserId: owner, Name: "Books"}, {UserId: other, Name: "Gifts"}} {
+		if _, err := mgr.Insert(ctx, w, constant.WishlistCollection); err != nil {
+			t.Fatalf("insert %+v error = %v", w, err)
+		}
+	}
+	if _, err := mgr.Insert(ctx, types.Wishlist{UserId: owner, Name: "Gifts"}, constant.WishlistCollection); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("duplicate wishlist error = %v, want a duplicate key error", err)
+	}
+
+	// a SKU may only appear in one product, and products without variants don't collide
+	shirt := types.Product{Name: "Shirt", Variants: []types.Variant{{SKU: "S"}, {SKU: "M"}}}
+	for _, p := range []types.Product{shirt, {Name: "Mug"}, {Name: "Lamp"}} {
+		if _, err := mgr.Insert(ctx, p, constant.ProductCollection); err != nil {
+			t.Fatalf("insert %s error = %v", p.Name, err)
+		}
+	}
+	sock := types.Product{Name: "Sock", Variants: []types.Variant{{SKU: "L"}, {SKU: "M"}}}
+	if _, err := mgr.Insert(ctx, sock, constant.ProductCollection); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("product reusing a SKU error = %v, want a duplicate key error", err)
+	}
+}
@@ -3,9 +3,9 @@ package helper
 import (
 	"ecommerce-project/types"
 	"errors"
+	"fmt"
 	"strconv"
-
-	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
 func CheckUserValidation(u types.UserClient)(error){
@@ -24,15 +24,6 @@ func CheckUserValidation(u types.UserClient)(error){
 	return  nil
 }
 
-func GenPassHash(s string) string{
-	bytes, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.MinCost)
-	if err != nil {
-		return ""
-	}
-	return string(bytes)
-}
-
-
 func CheckProductValidation(p types.ProductClient)error{
 	if p.Description == ""{
 		return errors.New("description of product can't be empty")
@@ -41,10 +32,6 @@ func CheckProductValidation(p types.ProductClient)error{
 		return errors.New("name of product can't be empty")
 	}
 
-	if p.ImageUrl == ""{
-		return errors.New("description of product can't be empty")
-	}
-
 	if p.Price == 0{
 		return errors.New("price of product can't be 0")
 	}
@@ -59,4 +46,75 @@ func ConvertStringIntoInt (s string)int{
 	}
 	return val
 
-}
\ No newline at end of file
+}
+
+// CheckVariantValidation checks a product's option axes and variants: options
+// and variants come together, every
+// variant has a unique SKU and picks one allowed value of each option, no two
+// variants pick the same combination, and prices and stock aren't negative.
+func CheckVariantValidation(options []types.ProductOption, variants []types.Variant) error {
+	if len(variants) > 0 && len(options) == 0 {
+		return errors.New("variants need the product's options")
+	}
+	if len(options) > 0 && len(variants) == 0 {
+		return errors.New("options need at least one variant")
+	}
+
+	allowed := make(map[string]map[string]bool, len(options))
+	for _, o := range options {
+		if strings.TrimSpace(o.Name) == "" {
+			return errors.New("option name can't be empty")
+		}
+		if allowed[o.Name] != nil {
+			return fmt.Errorf("option %q is listed twice", o.Name)
+		}
+		if len(o.Values) == 0 {
+			return fmt.Errorf("option %q has no values", o.Name)
+		}
+		allowed[o.Name] = make(map[string]bool, len(o.Values))
+		for _, v := range o.Values {
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("option %q has an empty value", o.Name)
+			}
+			if allowed[o.Name][v] {
+				return fmt.Errorf("option %q lists %q twice", o.Name, v)
+			}
+			allowed[o.Name][v] = true
+		}
+	}
+
+	skus := make(map[string]bool, len(variants))
+	combinations := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		if strings.TrimSpace(v.SKU) == "" {
+			return errors.New("variant sku can't be empty")
+		}
+		if skus[v.SKU] {
+			return fmt.Errorf("sku %q is used by two variants", v.SKU)
+		}
+		skus[v.SKU] = true
+		if v.Price < 0 {
+			return fmt.Errorf("price of variant %q can't be negative", v.SKU)
+		}
+		if v.Stock < 0 {
+			return fmt.Errorf("stock of variant %q can't be negative", v.SKU)
+		}
+		if len(v.Options) != len(options) {
+			return fmt.Errorf("variant %q must pick one value of each option", v.SKU)
+		}
+		var key strings.Builder
+		for _, o := range options {
+			value, ok := v.Options[o.Name]
+			if !ok || !allowed[o.Name][value] {
+				return fmt.Errorf("variant %q has no valid %q", v.SKU, o.Name)
+			}
+			key.WriteString(value)
+			key.WriteByte(0)
+		}
+		if combinations[key.String()] {
+			return fmt.Errorf("variant %q repeats the options of another variant", v.SKU)
+		}
+		combinations[key.String()] = true
+	}
+	return nil
+}
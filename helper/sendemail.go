@@ -1,29 +1,95 @@
 package helper
 
 import (
-	"ecommerce-project/constant"
+	"context"
+	"ecommerce-project/config"
 	"ecommerce-project/types"
 	"errors"
+	"html"
 	"math/rand"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func SendEmailSendGrid(req types.Verification)(types.Verification, error){
-	apiKey := os.Getenv("SENDGRID_API_KEY")
-	if apiKey == ""{
-		return req, errors.New("SENDGRID_API_KEY environment variable is not set")
+// OtpSender generates an OTP for req.Email, delivers it and returns req with the OTP set.
+type OtpSender interface {
+	SendOtp(ctx context.Context, req types.Verification) (types.Verification, error)
+	// NotifyEmailChanged tells the previous address of an account that its email was changed.
+	NotifyEmailChanged(ctx context.Context, oldEmail, newEmail string) error
+	// Ready reports why the sender cannot deliver mail, or nil if it can.
+	Ready() error
+}
+
+// SendGridSender delivers OTP mails through SendGrid.
+type SendGridSender struct {
+	cfg config.Email
+}
+
+// NewSendGridSender returns an OtpSender using the SendGrid key and sender address from cfg.
+func NewSendGridSender(cfg config.Email) SendGridSender {
+	return SendGridSender{cfg: cfg}
+}
+
+func (s SendGridSender) Ready() error {
+	if s.cfg.SendGridAPIKey == "" {
+		return errors.New("SENDGRID_API_KEY is not configured")
+	}
+	return nil
+}
+
+// SendOtp sends the OTP mail inside an "email.send_otp" span, so slow or failing
+// SendGrid calls show up in the request's trace.
+func (s SendGridSender) SendOtp(ctx context.Context, req types.Verification) (types.Verification, error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "email.send_otp", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("email.provider", "sendgrid")))
+	defer span.End()
+
+	req, err := SendEmailSendGrid(ctx, s.cfg, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sending otp failed")
+	}
+	return req, err
+}
+
+// NotifyEmailChanged sends the notice inside an "email.notify_email_changed" span.
+func (s SendGridSender) NotifyEmailChanged(ctx context.Context, oldEmail, newEmail string) error {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "email.notify_email_changed", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("email.provider", "sendgrid")))
+	defer span.End()
+
+	err := SendEmailChangedNotice(ctx, s.cfg, oldEmail, newEmail)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sending notice failed")
+	}
+	return err
+}
+
+// tracerName identifies the spans this package creates.
+const tracerName = "ecommerce-project/helper"
+
+// Mailer is the OtpSender used by the handlers. main installs the configured
+// sender at startup; tests swap it for a fake.
+var Mailer OtpSender = SendGridSender{}
+
+func SendEmailSendGrid(ctx context.Context, cfg config.Email, req types.Verification)(types.Verification, error){
+	if cfg.SendGridAPIKey == ""{
+		return req, errors.New("SENDGRID_API_KEY is not configured")
 	}
 
 	// Create a SendGrid client
-	client := sendgrid.NewSendClient(apiKey)
+	client := sendgrid.NewSendClient(cfg.SendGridAPIKey)
 
 	// Set up the email message
-	from := mail.NewEmail("Sender Name", constant.Sender)
+	from := mail.NewEmail("Sender Name", cfg.Sender)
 	to := mail.NewEmail("Recipient Name", req.Email)
 	subject := "OTP verification mail"
 
@@ -33,14 +99,38 @@ func SendEmailSendGrid(req types.Verification)(types.Verification, error){
 	message := mail.NewSingleEmail(from, subject, to, "", htmlContent)
 
 	// Send the email message
-	_, err := client.Send(message)
+	resp, err := client.SendWithContext(ctx, message)
 	if err != nil {
 		return req, err
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	return req, nil;
 }
 
+// SendEmailChangedNotice warns oldEmail that the account now uses newEmail, so
+// an owner who didn't ask for the change can react.
+func SendEmailChangedNotice(ctx context.Context, cfg config.Email, oldEmail, newEmail string) error {
+	if cfg.SendGridAPIKey == "" {
+		return errors.New("SENDGRID_API_KEY is not configured")
+	}
+
+	client := sendgrid.NewSendClient(cfg.SendGridAPIKey)
+	from := mail.NewEmail("Sender Name", cfg.Sender)
+	to := mail.NewEmail("Recipient Name", oldEmail)
+	subject := "Your account email was changed"
+	htmlContent := "<p>The email address of your account was changed to <strong>" + html.EscapeString(newEmail) +
+		"</strong>. If you didn't make this change, contact support straight away.</p>"
+	message := mail.NewSingleEmail(from, subject, to, "", htmlContent)
+
+	resp, err := client.SendWithContext(ctx, message)
+	if err != nil {
+		return err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	return nil
+}
+
 func Randomnum() int {
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
   return rng.Intn(1000)+1000 // OTP length of 4 digits
@@ -0,0 +1,118 @@
+// Package imaging checks uploaded images and makes thumbnails of them using
+// only the standard library decoders: JPEG, PNG and GIF.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// Content types of the images Inspect accepts.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+)
+
+// maxPixels bounds the decoded size of an image, so a small file that
+// expands to a huge bitmap can't exhaust memory.
+const maxPixels = 25_000_000
+
+var (
+	// ErrUnsupportedType is returned for anything but a JPEG, PNG or GIF image.
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are accepted")
+	// ErrTooLarge is returned for images with more than maxPixels pixels.
+	ErrTooLarge = fmt.Errorf("images can't have more than %d pixels", maxPixels)
+)
+
+// Info describes an image that passed Inspect.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect identifies the image in data by its content rather than by what the
+// client claims, and reads its dimensions without decoding the pixels.
+func Inspect(data []byte) (Info, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != JPEG && contentType != PNG && contentType != GIF {
+		return Info{}, ErrUnsupportedType
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, fmt.Errorf("reading image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return Info{}, errors.New("image has no pixels")
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return Info{}, ErrTooLarge
+	}
+	return Info{ContentType: contentType, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Thumbnail scales the image in data down to fit in size×size, keeping its
+// aspect ratio; smaller images keep their size. JPEGs stay JPEGs, while PNGs
+// and GIFs become PNGs so transparency survives. Animated GIFs use their
+// first frame. It returns the encoded thumbnail and its content type.
+func Thumbnail(data []byte, size int) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image: %w", err)
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	thumb := scale(src, w, h)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), JPEG, err
+	}
+	err = png.Encode(&buf, thumb)
+	return buf.Bytes(), PNG, err
+}
+
+// scale resizes src to w×h by averaging the source pixels each destination
+// pixel covers, which keeps downscaled images smooth.
+func scale(src image.Image, w, h int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*sw/w, b.Min.X+max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// RGBA is alpha-premultiplied, so averaging it is correct
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			c := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)}
+			dst.Set(x, y, c)
+		}
+	}
+	return dst
+}
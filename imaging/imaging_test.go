@@ -0,0 +1,45 @@
+package imaging
+
+import (
+	"ecommerce-project/imaging/imagingtest"
+	"errors"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	info, err := Inspect(imagingtest.Encode(t, 64, 32, false))
+	if err != nil || info != (Info{ContentType: PNG, Width: 64, Height: 32}) {
+		t.Errorf("Inspect(png) = %+v, %v", info, err)
+	}
+	if _, err := Inspect([]byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Inspect(svg) error = %v, want ErrUnsupportedType", err)
+	}
+	if _, err := Inspect(append([]byte("\x89PNG\r\n\x1a\n"), "broken"...)); err == nil {
+		t.Error("Inspect(truncated png) succeeded")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		data         []byte
+		wantType     string
+		wantW, wantH int
+	}{
+		{"wide png", imagingtest.Encode(t, 640, 320, false), PNG, 320, 160},
+		{"tall jpeg", imagingtest.Encode(t, 200, 800, true), JPEG, 80, 320},
+		{"small png", imagingtest.Encode(t, 100, 50, false), PNG, 100, 50},
+	} {
+		thumb, contentType, err := Thumbnail(tc.data, 320)
+		if err != nil {
+			t.Fatalf("%s: Thumbnail() error = %v", tc.name, err)
+		}
+		info, err := Inspect(thumb)
+		if err != nil {
+			t.Fatalf("%s: Inspect(thumbnail) error = %v", tc.name, err)
+		}
+		if contentType != tc.wantType || info.ContentType != tc.wantType || info.Width != tc.wantW || info.Height != tc.wantH {
+			t.Errorf("%s: thumbnail = %s %+v, want %s %dx%d", tc.name, contentType, info, tc.wantType, tc.wantW, tc.wantH)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package imagingtest provides the test images shared by the imaging tests and
+// the API tests that upload them.
+package imagingtest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// Encode returns a w×h gradient encoded as JPEG or PNG, failing t if that
+// doesn't work.
+func Encode(t testing.TB, w, h int, asJPEG bool) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if asJPEG {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	return buf.Bytes()
+}
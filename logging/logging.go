@@ -0,0 +1,93 @@
+// Package logging configures the process-wide structured logger.
+//
+// Records are written as JSON through log/slog. Attributes attached to a context
+// with With (request ID, route, user ID) are added to every record logged with
+// that context, so handlers and the database layer only need slog.InfoContext.
+package logging
+
+import (
+	"context"
+	"ecommerce-project/config"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the value of any attribute whose key looks sensitive.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively as substrings of attribute keys.
+var sensitiveKeys = []string{"password", "otp", "token", "secret", "authorization", "api_key", "apikey"}
+
+// New builds a logger writing to w at the configured level and format.
+func New(w io.Writer, cfg config.Log) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redact}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case config.TextLogFormat:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel maps debug, info, warn or error to a slog level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// redact hides the values of sensitive attributes wherever they appear, including
+// inside groups. It can't see into structs, so never log whole request or user values.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+	return a
+}
+
+type attrsKey struct{}
+
+// With returns a copy of ctx whose log records carry attrs in addition to any
+// attributes already attached.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+// contextHandler adds the attributes stored by With to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
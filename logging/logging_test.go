@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-project/config"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestLogger(t *testing.T, level string) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, config.Log{Level: level, Format: config.JSONLogFormat})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return logger, &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var r map[string]any
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("decoding log line: %v", err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestRedactsSensitiveAttributes(t *testing.T) {
+	logger, buf := newTestLogger(t, "info")
+
+	logger.Info("login", "email", "a@test.local", "password", "hunter2", "otp", 123456,
+		slog.Group("req", "Authorization", "Bearer abc", "refresh_token", "xyz"))
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "123456", "Bearer abc", "xyz"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log line leaked %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "a@test.local") {
+		t.Errorf("log line dropped a non-sensitive field: %s", out)
+	}
+}
+
+func TestLevelFiltersRecords(t *testing.T) {
+	logger, buf := newTestLogger(t, "warn")
+
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	records := decodeLines(t, buf)
+	if len(records) != 1 || records[0]["msg"] != "kept" {
+		t.Fatalf("records = %v, want only the warning", records)
+	}
+
+	if _, err := New(buf, config.Log{Level: "loud"}); err == nil {
+		t.Error("New() accepted an unknown level")
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	logger, buf := newTestLogger(t, "info")
+
+	ctx := With(context.Background(), slog.String("request_id", "r1"))
+	ctx = With(ctx, slog.String("user_id", "u1"))
+	logger.InfoContext(ctx, "hello")
+
+	records := decodeLines(t, buf)
+	if len(records) != 1 || records[0]["request_id"] != "r1" || records[0]["user_id"] != "u1" {
+		t.Fatalf("records = %v, want request and user IDs from the context", records)
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, buf := newTestLogger(t, "info")
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	engine := gin.New()
+	engine.Use(Middleware())
+	engine.GET("/items/:id", func(c *gin.Context) {
+		Annotate(c, slog.String("user_id", "u1"))
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/7?token=secret", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "client-id-1" {
+		t.Errorf("response request ID = %q, want the client's", got)
+	}
+
+	records := decodeLines(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("records = %v, want one access record", records)
+	}
+	r := records[0]
+	if r["request_id"] != "client-id-1" || r["route"] != "/items/:id" || r["user_id"] != "u1" || r["status"] != float64(http.StatusNoContent) {
+		t.Errorf("access record = %v", r)
+	}
+	if r["path"] != "/items/7" {
+		t.Errorf("path = %v, want it without the query string", r["path"])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/items/7", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n{}")
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got == "" || got == "bad id\n{}" {
+		t.Errorf("response request ID = %q, want a generated one", got)
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key the request ID is stored under.
+const requestIDKey = "request_id"
+
+// maxRequestIDLength bounds IDs accepted from clients so they can't bloat the logs.
+const maxRequestIDLength = 128
+
+// Middleware assigns every request an ID, echoes it in the X-Request-ID response
+// header and attaches it to the request context along with the matched route and,
+// when the request is traced, the trace ID. A valid client-supplied ID is kept so
+// calls can be followed across services. Once the handler returns it writes one
+// access record; the query string is left out because it may carry user input.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		attrs := []slog.Attr{slog.String("request_id", id)}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		Annotate(c, attrs...)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// Annotate attaches attrs to the log records of the rest of the request,
+// for example the user ID once the token has been validated.
+func Annotate(c *gin.Context, attrs ...slog.Attr) {
+	c.Request = c.Request.WithContext(With(c.Request.Context(), attrs...))
+}
+
+// RequestID returns the ID assigned by Middleware, or "" outside a request.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Recovery turns a panic into a 500 and logs it with the request's attributes
+// instead of gin's plain-text stack dump.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "panic recovered", "panic", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": true, "message": http.StatusText(http.StatusInternalServerError)})
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
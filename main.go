@@ -1,53 +1,125 @@
 package main
 
 import (
-	"ecommerce-project/constant"
+	"context"
+	"ecommerce-project/config"
 	"ecommerce-project/database"
 	"ecommerce-project/helper"
+	"ecommerce-project/logging"
+	"ecommerce-project/password"
 	"ecommerce-project/router"
-	"ecommerce-project/types"
-	"log"
+	"ecommerce-project/storage"
+	"ecommerce-project/tracing"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/gin-gonic/gin"
 )
 
-// init func runs before main func
+func main() {
+	command := run
+	if len(os.Args) > 1 && os.Args[1] == "createadmin" {
+		command = func() error { return createAdmin(os.Args[2:]) }
+	}
+	if err := command(); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(1)
+	}
+}
 
-func init() {
-	if _, err := os.Stat(".env"); err == nil {
-		log.Println("Loading the config from .env file")
-		err = godotenv.Load(".env")
+// run starts the API and blocks until it fails or receives SIGINT/SIGTERM.
+// On a signal it stops accepting connections, lets in-flight requests finish
+// within the shutdown timeout and then disconnects from the database.
+func run() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			log.Println("Error loading .env config file")
+	logger, err := logging.New(os.Stdout, cfg.Log)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flushing traces", "err", err)
 		}
-		log.Println("Successfully loaded the config file")
+	}()
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
 	}
-	database.ConnectDb()
 
-	// creating system admin
-	hashPassword := helper.GenPassHash("1234")
-	user := types.User{
-		Name:     "Admin",
-		Email:    "admin@gmail.com",
-		Password: hashPassword,
-		UserType: constant.AdminUser,
+	// createadmin can't reach the in-process store, so ADMIN_EMAIL is the only
+	// way to get an admin into it
+	if cfg.Database.Driver == config.MemoryDriver && cfg.Admin.Email == "" {
+		slog.Warn("DB_DRIVER=memory without ADMIN_EMAIL: the store has no admin, so admin routes are unusable; set ADMIN_EMAIL and ADMIN_PASSWORD_FILE to create one")
+	}
+	if err := database.Connect(cfg.Database); err != nil {
+		return err
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		database.Close(ctx)
+	}()
 
-	u := database.Mgr.GetSingleRecordByEmailForUser(user.Email, constant.UserCollection)
-	
-	if u.Email == "" {
-		// insertion query to db
-		_, err := database.Mgr.Insert(user, constant.UserCollection)
+	if cfg.Database.AutoMigrate {
+		if err := database.Mgr.Migrate(context.Background()); err != nil {
+			return err
+		}
+	}
 
-		if err != nil {
-			log.Fatal(err)
+	helper.Mailer = helper.NewSendGridSender(cfg.Email)
+	if password.Mgr, err = password.New(cfg.Password); err != nil {
+		return err
+	}
+	if err := bootstrapAdmin(context.Background(), cfg.Admin); err != nil {
+		return err
+	}
+	if storage.Files, err = storage.New(cfg.Storage); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server, err := router.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
+		return nil
+	case <-ctx.Done():
 	}
 
-}
+	stop()
+	slog.Info("shutting down, draining in-flight requests")
 
-func main() {
-	router.ClientRoutes()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
 }
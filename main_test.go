@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/password"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	database.ConnectMemory()
+	if err := database.Mgr.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	policy := config.Default().Password
+	policy.BcryptCost = bcrypt.MinCost
+	m, err := password.New(policy)
+	if err != nil {
+		t.Fatalf("password.New() error = %v", err)
+	}
+	previous := password.Mgr
+	password.Mgr = m
+	t.Cleanup(func() { password.Mgr = previous })
+
+	if err := bootstrapAdmin(ctx, config.Admin{}); err != nil {
+		t.Fatalf("bootstrapAdmin() without an email error = %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "admin_password")
+	if err := os.WriteFile(file, []byte("first-admin-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Admin{Email: "root@shop.example.com", Name: "Root", PasswordFile: file}
+	if err := bootstrapAdmin(ctx, cfg); err != nil {
+		t.Fatalf("bootstrapAdmin() error = %v", err)
+	}
+	admin, err := database.Mgr.GetSingleRecordByEmailForUser(ctx, cfg.Email, constant.UserCollection)
+	if err != nil || admin.UserType != constant.AdminUser || !admin.PasswordChangeRequired || admin.Name != "Root" {
+		t.Fatalf("bootstrapped admin = %+v, %v", admin, err)
+	}
+	if ok, _, err := password.Mgr.Verify(admin.Password, "first-admin-password"); err != nil || !ok {
+		t.Error("admin password doesn't match the file")
+	}
+
+	// later starts leave the account alone and no longer need the file
+	os.Remove(file)
+	if err := bootstrapAdmin(ctx, cfg); err != nil {
+		t.Errorf("bootstrapAdmin() for an existing admin error = %v", err)
+	}
+	cfg.Email = "other@shop.example.com"
+	if err := bootstrapAdmin(ctx, cfg); err == nil {
+		t.Error("bootstrapAdmin() with a missing password file succeeded")
+	}
+}
@@ -0,0 +1,50 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:embed docs.html
+var docsPage string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsPage))
+
+// SpecHandler serves doc as JSON. The document is encoded once, up front.
+func SpecHandler(doc *Document) gin.HandlerFunc {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		panic("openapi: encoding document: " + err.Error())
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// DocsHandler serves a Swagger UI page that renders the document at specURL,
+// loading the UI from assetsURL (see AssetsHandler).
+func DocsHandler(specURL, assetsURL string) gin.HandlerFunc {
+	var page bytes.Buffer
+	data := struct{ SpecURL, AssetsURL string }{specURL, assetsURL}
+	if err := docsTemplate.Execute(&page, data); err != nil {
+		panic("openapi: rendering docs page: " + err.Error())
+	}
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+	}
+}
+
+// AssetsHandler serves the Swagger UI files embedded in the binary, so the docs
+// work without reaching a CDN. Register it on a route ending in *filepath.
+func AssetsHandler() gin.HandlerFunc {
+	assets := http.FS(swaggerFiles.FS)
+	return func(c *gin.Context) {
+		c.FileFromFS(c.Param("filepath"), assets)
+	}
+}
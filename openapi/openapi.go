@@ -0,0 +1,371 @@
+// Package openapi generates an OpenAPI 3 document from the route table and the
+// Go types each route accepts and returns.
+//
+// Schemas are derived by reflection the same way encoding/json and gin's form
+// binding read the structs: `json` fields make up request and response bodies,
+// `form` fields become query parameters, and embedded structs are flattened.
+// A request type with a file field is a multipart form instead, documented
+// as a body with all of its `form` fields.
+package openapi
+
+import (
+	"mime/multipart"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version is the OpenAPI version of the generated document.
+const Version = "3.0.3"
+
+// bearerScheme names the JWT security scheme secured operations reference.
+const bearerScheme = "bearerAuth"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem maps a lower-case HTTP method to its operation.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Alternatives is implemented by types that stand for one of several shapes,
+// such as response data that depends on who asks. They are documented as a
+// oneOf of the types of the values OneOf returns.
+type Alternatives interface {
+	OneOf() []interface{}
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Route describes one registered endpoint.
+type Route struct {
+	Name   string
+	Method string
+	// Path is the full gin path, e.g. /api/v1/ecommerce/user/:id.
+	Path string
+	Tag  string
+	// Description adds free-form notes, such as the roles the route requires.
+	Description string
+	// Secured routes require a bearer token.
+	Secured bool
+	// Request is a value of the type bound from the request: its `form` fields are
+	// documented as query parameters and its `json` fields as the body, unless it
+	// has a *multipart.FileHeader field, which makes the `form` fields a
+	// multipart body. May be nil.
+	Request interface{}
+	// Response is a value of the type returned on success. May be nil.
+	Response   interface{}
+	Deprecated bool
+}
+
+// errorResponse documents the body returned on failure.
+var errorResponse = Response{
+	Description: "The request failed; message explains why.",
+	Content: map[string]MediaType{"application/json": {Schema: &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"error":   {Type: "boolean"},
+			"message": {Type: "string"},
+		},
+	}}},
+}
+
+var pathParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Generate builds the document for routes.
+func Generate(info Info, routes []Route) *Document {
+	g := generator{schemas: map[string]*Schema{}}
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerScheme: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+
+	for _, r := range routes {
+		path := pathParam.ReplaceAllString(r.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = g.operation(r)
+	}
+	return doc
+}
+
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func (g *generator) operation(r Route) *Operation {
+	op := &Operation{
+		Summary:     r.Name,
+		Description: r.Description,
+		OperationID: operationID(r.Name),
+		Responses:   map[string]Response{"default": errorResponse},
+		Deprecated:  r.Deprecated,
+	}
+	if r.Tag != "" {
+		op.Tags = []string{r.Tag}
+	}
+	if r.Secured {
+		op.Security = []map[string][]string{{bearerScheme: {}}}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(r.Path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+
+	if r.Request != nil {
+		t := indirect(reflect.TypeOf(r.Request))
+		if hasFile(t) {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"multipart/form-data": {Schema: g.form(t)}},
+			}
+		} else {
+			op.Parameters = append(op.Parameters, g.queryParameters(t)...)
+		}
+		if hasTag(t, "json") {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: g.schema(t)}},
+			}
+		}
+	}
+
+	ok := Response{Description: "Success"}
+	if r.Response != nil {
+		ok.Content = map[string]MediaType{"application/json": {Schema: g.schema(reflect.TypeOf(r.Response))}}
+	}
+	op.Responses["200"] = ok
+	return op
+}
+
+// operationID turns a route name such as "Add to cart" into addToCart.
+func operationID(name string) string {
+	words := strings.Fields(name)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if i > 0 {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		words[i] = w
+	}
+	return strings.Join(words, "")
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+	fileType     = reflect.TypeOf(multipart.FileHeader{})
+)
+
+// schema returns the schema for t, registering named structs as components.
+func (g *generator) schema(t reflect.Type) *Schema {
+	t = indirect(t)
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case objectIDType:
+		return &Schema{Type: "string", Pattern: "^[0-9a-f]{24}$", Description: "MongoDB ObjectID"}
+	case fileType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// reserve the name first so recursive types terminate
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.named(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	// interface{} and anything else accepts any value
+	return &Schema{}
+}
+
+// named builds the schema registered for the named struct t.
+func (g *generator) named(t reflect.Type) *Schema {
+	alts, ok := reflect.Zero(t).Interface().(Alternatives)
+	if !ok {
+		return g.object(t)
+	}
+	s := &Schema{}
+	for _, v := range alts.OneOf() {
+		s.OneOf = append(s.OneOf, g.schema(reflect.TypeOf(v)))
+	}
+	return s
+}
+
+// object builds an inline object schema from the json fields of t.
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	eachField(t, "json", func(name string, f reflect.StructField) {
+		s.Properties[name] = g.schema(f.Type)
+	})
+	return s
+}
+
+// form builds an inline object schema from the form fields of t, for multipart bodies.
+func (g *generator) form(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	eachField(t, "form", func(name string, f reflect.StructField) {
+		s.Properties[name] = g.schema(f.Type)
+	})
+	return s
+}
+
+// hasFile reports whether t has a form field holding an uploaded file.
+func hasFile(t reflect.Type) bool {
+	found := false
+	eachField(t, "form", func(_ string, f reflect.StructField) {
+		found = found || indirect(f.Type) == fileType
+	})
+	return found
+}
+
+// queryParameters documents the form fields of t as optional query parameters.
+func (g *generator) queryParameters(t reflect.Type) []Parameter {
+	var params []Parameter
+	eachField(t, "form", func(name string, f reflect.StructField) {
+		params = append(params, Parameter{Name: name, In: "query", Schema: g.schema(f.Type)})
+	})
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+func hasTag(t reflect.Type, tag string) bool {
+	found := false
+	eachField(t, tag, func(string, reflect.StructField) { found = true })
+	return found
+}
+
+// eachField calls fn for every exported field of struct t carrying tag, descending
+// into embedded structs the way encoding/json does.
+func eachField(t reflect.Type, tag string, fn func(name string, f reflect.StructField)) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		value, tagged := f.Tag.Lookup(tag)
+		name := strings.Split(value, ",")[0]
+
+		if f.Anonymous && !tagged && indirect(f.Type).Kind() == reflect.Struct {
+			eachField(indirect(f.Type), tag, fn)
+			continue
+		}
+		if !f.IsExported() || !tagged || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fn(name, f)
+	}
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,110 @@
+package openapi
+
+import (
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type envelope struct {
+	Error bool `json:"error"`
+}
+
+type item struct {
+	ID    primitive.ObjectID     `json:"_id"`
+	Tags  []string               `json:"tags,omitempty"`
+	Meta  map[string]interface{} `json:"meta"`
+	Owner *item                  `json:"owner"`
+	skip  string
+}
+
+type itemResponse struct {
+	envelope
+	Data item `json:"data"`
+}
+
+type itemSummary struct {
+	ID primitive.ObjectID `json:"_id"`
+}
+
+type itemView struct{}
+
+func (itemView) OneOf() []interface{} { return []interface{}{item{}, itemSummary{}} }
+
+type itemViewResponse struct {
+	envelope
+	Data itemView `json:"data"`
+}
+
+type itemUpload struct {
+	Picture *multipart.FileHeader `form:"picture"`
+	Caption string                `form:"caption"`
+}
+
+type itemQuery struct {
+	Page   int    `form:"page"`
+	Filter string `form:"filter"`
+}
+
+func TestGenerate(t *testing.T) {
+	doc := Generate(Info{Title: "test", Version: "v1"}, []Route{
+		{Name: "Get item", Method: http.MethodGet, Path: "/items/:id", Secured: true, Request: itemQuery{}, Response: itemResponse{}},
+		{Name: "Create item", Method: http.MethodPost, Path: "/items", Request: item{}},
+		{Name: "Upload picture", Method: http.MethodPost, Path: "/items/:id/picture", Request: itemUpload{}},
+		{Name: "View item", Method: http.MethodGet, Path: "/items/:id/view", Response: itemViewResponse{}},
+	})
+
+	get := doc.Paths["/items/{id}"]["get"]
+	if get == nil {
+		t.Fatalf("paths = %v, want /items/{id} with a get operation", doc.Paths)
+	}
+	if get.OperationID != "getItem" || len(get.Security) != 1 || get.RequestBody != nil {
+		t.Errorf("get operation = %+v", get)
+	}
+
+	var names []string
+	for _, p := range get.Parameters {
+		names = append(names, p.In+":"+p.Name)
+	}
+	if len(names) != 3 || names[0] != "path:id" || names[1] != "query:filter" || names[2] != "query:page" {
+		t.Errorf("parameters = %v, want the path id then the sorted query fields", names)
+	}
+
+	resp := doc.Components.Schemas["itemResponse"]
+	if resp == nil || resp.Properties["error"] == nil || resp.Properties["data"].Ref != "#/components/schemas/item" {
+		t.Fatalf("itemResponse schema = %+v, want the embedded envelope flattened and data referencing item", resp)
+	}
+
+	it := doc.Components.Schemas["item"]
+	if it.Properties["_id"].Type != "string" || it.Properties["tags"].Items.Type != "string" ||
+		it.Properties["meta"].Type != "object" || it.Properties["owner"].Ref != "#/components/schemas/item" {
+		t.Errorf("item schema = %+v", it.Properties)
+	}
+	if _, ok := it.Properties["skip"]; ok {
+		t.Error("unexported field documented")
+	}
+
+	view := doc.Components.Schemas["itemView"]
+	if view == nil || len(view.OneOf) != 2 || view.OneOf[0].Ref != "#/components/schemas/item" || view.OneOf[1].Ref != "#/components/schemas/itemSummary" {
+		t.Errorf("itemView schema = %+v, want a oneOf of item and itemSummary", view)
+	}
+
+	post := doc.Paths["/items"]["post"]
+	if post.RequestBody == nil || post.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/item" {
+		t.Errorf("post request body = %+v", post.RequestBody)
+	}
+	if post.Security != nil {
+		t.Error("unsecured route lists a security requirement")
+	}
+
+	upload := doc.Paths["/items/{id}/picture"]["post"]
+	if len(upload.Parameters) != 1 || upload.RequestBody == nil {
+		t.Fatalf("upload operation = %+v, want the path id and a body", upload)
+	}
+	form := upload.RequestBody.Content["multipart/form-data"].Schema
+	if form == nil || form.Properties["picture"].Format != "binary" || form.Properties["caption"].Type != "string" {
+		t.Errorf("upload body = %+v, want a multipart form with a binary picture", upload.RequestBody)
+	}
+}
@@ -0,0 +1,197 @@
+// Package password hashes, verifies and vets user passwords according to the
+// configured policy.
+//
+// New hashes use the configured algorithm, bcrypt or argon2id. Verify accepts
+// hashes made by either and reports when one was made with a different
+// algorithm or weaker parameters, so callers can upgrade it while the
+// plaintext is at hand, at login.
+package password
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"ecommerce-project/config"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxLength bounds passwords so hashing cost can't be abused; bcrypt itself
+// rejects anything longer than 72 bytes.
+const (
+	maxLength       = 72
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+)
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = fmt.Errorf("password can't be longer than %d bytes", maxLength)
+	ErrBreached = errors.New("password appears in a list of breached passwords; choose another one")
+	// ErrUnknownHash is returned by Verify for a stored hash in no known format.
+	ErrUnknownHash = errors.New("unrecognised password hash")
+)
+
+// Manager applies one password policy.
+type Manager struct {
+	cfg config.Password
+	// breached holds the upper-case SHA-1 hex of every breached password, so the
+	// plaintext list isn't kept in memory.
+	breached map[string]struct{}
+}
+
+// Mgr is the Manager used by the handlers. main installs the configured one.
+var Mgr *Manager
+
+// New builds a Manager for cfg, loading the breached-password list if one is configured.
+func New(cfg config.Password) (*Manager, error) {
+	m := &Manager{cfg: cfg, breached: map[string]struct{}{}}
+	if cfg.BreachedListFile == "" {
+		return m, nil
+	}
+
+	f, err := os.Open(cfg.BreachedListFile)
+	if err != nil {
+		return nil, fmt.Errorf("opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			m.breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		m.breached[digestOf(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading breached password list: %w", err)
+	}
+	return m, nil
+}
+
+// Validate checks a new password against the policy. The error is safe to show to the user.
+func (m *Manager) Validate(password string) error {
+	switch {
+	case utf8.RuneCountInString(password) < m.cfg.MinLength:
+		return fmt.Errorf("%w: use at least %d characters", ErrTooShort, m.cfg.MinLength)
+	case len(password) > maxLength:
+		return ErrTooLong
+	}
+	if _, ok := m.breached[digestOf(password)]; ok {
+		return ErrBreached
+	}
+	return nil
+}
+
+// Hash hashes password with the configured algorithm.
+func (m *Manager) Hash(password string) (string, error) {
+	if m.cfg.Algorithm == config.Argon2idAlgorithm {
+		salt := make([]byte, argon2SaltBytes)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("generating salt: %w", err)
+		}
+		p := m.argon2Params()
+		key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyBytes)
+		return p.encode(salt, key), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), m.cfg.BcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches hash and, if it does, whether hash
+// should be replaced by a fresh one because the policy has been strengthened
+// since it was made.
+func (m *Manager) Verify(hash, password string) (ok, rehash bool, err error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, false, err
+		}
+		got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, false, nil
+		}
+		return true, m.cfg.Algorithm != config.Argon2idAlgorithm || p.weakerThan(m.argon2Params()), nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false, nil
+	}
+	return true, m.cfg.Algorithm != config.BcryptAlgorithm || cost < m.cfg.BcryptCost, nil
+}
+
+type argon2Params struct {
+	time, memory uint32
+	threads      uint8
+}
+
+func (m *Manager) argon2Params() argon2Params {
+	return argon2Params{time: uint32(m.cfg.Argon2Time), memory: uint32(m.cfg.Argon2MemoryKiB), threads: uint8(m.cfg.Argon2Threads)}
+}
+
+func (p argon2Params) weakerThan(q argon2Params) bool {
+	return p.time < q.time || p.memory < q.memory || p.threads < q.threads
+}
+
+// encode writes the PHC string format used by the reference implementation:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (p argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+	return p, salt, key, nil
+}
+
+func digestOf(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
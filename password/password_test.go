@@ -0,0 +1,110 @@
+package password
+
+import (
+	"ecommerce-project/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testConfig() config.Password {
+	cfg := config.Default().Password
+	cfg.BcryptCost = bcrypt.MinCost + 1
+	cfg.Argon2MemoryKiB = 64
+	return cfg
+}
+
+func mustNew(t *testing.T, cfg config.Password) *Manager {
+	t.Helper()
+
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{config.BcryptAlgorithm, config.Argon2idAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Algorithm = algorithm
+			m := mustNew(t, cfg)
+
+			hash, err := m.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if ok, rehash, err := m.Verify(hash, "correct horse"); !ok || rehash || err != nil {
+				t.Errorf("Verify(right) = %v, %v, %v", ok, rehash, err)
+			}
+			if ok, _, err := m.Verify(hash, "battery staple"); ok || err != nil {
+				t.Errorf("Verify(wrong) = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyFlagsWeakerHashes(t *testing.T) {
+	weak := testConfig()
+	strong := testConfig()
+	strong.BcryptCost++
+
+	hash, _ := mustNew(t, weak).Hash("correct horse")
+	if ok, rehash, _ := mustNew(t, strong).Verify(hash, "correct horse"); !ok || !rehash {
+		t.Errorf("lower bcrypt cost: ok %v, rehash %v", ok, rehash)
+	}
+
+	argon := testConfig()
+	argon.Algorithm = config.Argon2idAlgorithm
+	if ok, rehash, _ := mustNew(t, argon).Verify(hash, "correct horse"); !ok || !rehash {
+		t.Errorf("bcrypt under argon2id policy: ok %v, rehash %v", ok, rehash)
+	}
+
+	argonHash, _ := mustNew(t, argon).Hash("correct horse")
+	argon.Argon2Time++
+	if ok, rehash, _ := mustNew(t, argon).Verify(argonHash, "correct horse"); !ok || !rehash {
+		t.Errorf("fewer argon2 passes: ok %v, rehash %v", ok, rehash)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=64,t=2,p=1$") {
+		t.Errorf("argon2 hash %q", argonHash)
+	}
+
+	if _, _, err := mustNew(t, weak).Verify("plaintext", "plaintext"); !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("Verify(plaintext) error = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "password123\n" +
+		// SHA-1 of "letmein-please", Pwned Passwords style
+		"B8C7E42D25F47C165216C1B0D35266300D7D219B:12\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	cfg.BreachedListFile = path
+	m := mustNew(t, cfg)
+
+	for pw, want := range map[string]error{
+		"long enough":           nil,
+		"short":                 ErrTooShort,
+		strings.Repeat("x", 73): ErrTooLong,
+		"password123":           ErrBreached,
+		"letmein-please":        ErrBreached,
+	} {
+		if err := m.Validate(pw); !errors.Is(err, want) {
+			t.Errorf("Validate(%q) = %v, want %v", pw, err, want)
+		}
+	}
+
+	cfg.BreachedListFile = filepath.Join(t.TempDir(), "missing.txt")
+	if _, err := New(cfg); err == nil {
+		t.Error("New accepted a missing breached list")
+	}
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"ecommerce-project/config"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// originPolicy matches request origins against the configured allowlist.
+type originPolicy struct {
+	any   bool
+	exact map[string]bool
+	// suffixes holds scheme://. and .domain pairs for "scheme://*.domain" entries
+	suffixes [][2]string
+}
+
+func newOriginPolicy(origins []string) originPolicy {
+	p := originPolicy{exact: map[string]bool{}}
+	for _, o := range origins {
+		o = strings.ToLower(strings.TrimSuffix(o, "/"))
+		switch {
+		case o == "*":
+			p.any = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(o, "://*")
+			p.suffixes = append(p.suffixes, [2]string{scheme + "://", domain})
+		default:
+			p.exact[o] = true
+		}
+	}
+	return p
+}
+
+func (p originPolicy) allows(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.any || p.exact[origin] {
+		return true
+	}
+	for _, s := range p.suffixes {
+		if host, ok := strings.CutPrefix(origin, s[0]); ok && len(host) > len(s[1]) && strings.HasSuffix(host, s[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors applies the CORS policy to every request. Requests from origins outside
+// the allowlist get no CORS headers, so browsers block them; preflights are
+// answered here and never reach a route.
+func cors(cfg config.CORS) gin.HandlerFunc {
+	policy := newOriginPolicy(cfg.AllowedOrigins)
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	anyHeader := headers == "*"
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+		if origin == "" || !policy.allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// a literal * can't be combined with credentials, so echo the origin instead
+		if policy.any && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		if anyHeader {
+			h.Set("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+		} else if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if cfg.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
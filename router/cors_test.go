@@ -0,0 +1,107 @@
+package router
+
+import (
+	"ecommerce-project/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsEngine(cfg config.CORS) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(cors(cfg))
+	engine.POST("/items", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return engine
+}
+
+func corsRequest(engine *gin.Engine, method, origin string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/items", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSAllowlist(t *testing.T) {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://shop.example.com", "https://*.example.org"}
+	cfg.AllowCredentials = true
+	engine := corsEngine(cfg)
+
+	for origin, allowed := range map[string]bool{
+		"https://shop.example.com":   true,
+		"https://SHOP.example.com":   true,
+		"https://admin.example.org":  true,
+		"https://a.b.example.org":    true,
+		"https://example.org":        false,
+		"http://admin.example.org":   false,
+		"https://evil-example.org":   false,
+		"https://shop.example.com.x": false,
+	} {
+		w := corsRequest(engine, http.MethodPost, origin, nil)
+		if w.Code != http.StatusCreated {
+			t.Errorf("%s: got %d, want the request served", origin, w.Code)
+		}
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if allowed && (got != origin || w.Header().Get("Access-Control-Allow-Credentials") != "true") {
+			t.Errorf("%s: allow origin %q, credentials %q", origin, got, w.Header().Get("Access-Control-Allow-Credentials"))
+		}
+		if !allowed && got != "" {
+			t.Errorf("%s: allowed as %q", origin, got)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://shop.example.com"}
+	engine := corsEngine(cfg)
+	preflight := map[string]string{
+		"Access-Control-Request-Method":  http.MethodPost,
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}
+
+	w := corsRequest(engine, http.MethodOptions, "https://shop.example.com", preflight)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight: got %d, want 204", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://shop.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type, X-Request-ID",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials allowed without AllowCredentials")
+	}
+
+	if w := corsRequest(engine, http.MethodOptions, "https://evil.example.net", preflight); w.Code != http.StatusForbidden {
+		t.Errorf("preflight from unlisted origin: got %d, want 403", w.Code)
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"*"}
+	engine := corsEngine(cfg)
+
+	w := corsRequest(engine, http.MethodPost, "https://anywhere.example", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("allow origin %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID, Retry-After, Deprecation, Link" {
+		t.Errorf("expose headers %q", got)
+	}
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/openapi"
+	"fmt"
+	"strings"
+)
+
+// apiSpec generates the OpenAPI document for the route groups NewRouter registers.
+func apiSpec(cfg *config.Config) *openapi.Document {
+	var routes []openapi.Route
+	for _, g := range routeGroups(cfg) {
+		for _, r := range g.Routes {
+			routes = append(routes, openapi.Route{
+				Name:        r.Name,
+				Method:      r.Method,
+				Path:        g.Prefix + r.Pattern,
+				Tag:         tag(g, r),
+				Description: describe(r),
+				Secured:     r.secured(),
+				Request:     r.Request,
+				Response:    r.Response,
+				Deprecated:  g.Deprecated,
+			})
+		}
+	}
+
+	info := openapi.Info{
+		Title:       "E-commerce API",
+		Version:     constant.APIVersion,
+		Description: "Authenticate with POST " + constant.APIPrefix + constant.AuthLoginRoute + " and send the token as `Authorization: Bearer <token>`.",
+	}
+	return openapi.Generate(info, routes)
+}
+
+// tag groups v1 routes by resource (the first path segment) and puts every legacy route under "legacy".
+func tag(g RouteGroup, r Route) string {
+	switch {
+	case g.Deprecated:
+		return "legacy"
+	case g.Prefix == "":
+		return "health"
+	}
+	return strings.Split(strings.TrimPrefix(r.Pattern, "/"), "/")[0]
+}
+
+// describe documents the role and rate limit guarding r, which the security
+// requirement alone doesn't convey.
+func describe(r Route) string {
+	var notes []string
+	if len(r.Roles) > 0 {
+		notes = append(notes, "Requires role: "+strings.Join(r.Roles, ", ")+".")
+	}
+	if r.RateLimit.Requests > 0 {
+		notes = append(notes, fmt.Sprintf("Limited to %d requests per %s per client IP.", r.RateLimit.Requests, r.RateLimit.Per))
+	}
+	return strings.Join(notes, " ")
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"ecommerce-project/constant"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiters hands out one limiter per RateLimit.Key, so every route naming
+// the same key, such as a v1 route and its legacy alias, draws on one budget
+// per client IP. Each router builds its own.
+type rateLimiters map[string]rateLimiter
+
+type rateLimiter struct {
+	limit   RateLimit
+	handler gin.HandlerFunc
+}
+
+// get returns the limiter for limit.Key, refusing a key declared with two
+// different limits.
+func (l rateLimiters) get(limit RateLimit) (gin.HandlerFunc, error) {
+	r, ok := l[limit.Key]
+	if !ok {
+		r = rateLimiter{limit: limit, handler: rateLimit(limit)}
+		l[limit.Key] = r
+	}
+	if r.limit != limit {
+		return nil, fmt.Errorf("rate limit %q is both %d per %s and %d per %s", limit.Key, r.limit.Requests, r.limit.Per, limit.Requests, limit.Per)
+	}
+	return r.handler, nil
+}
+
+// rateLimit lets each client IP make limit.Requests requests per limit.Per,
+// refilling evenly, and answers 429 with Retry-After beyond that. State is per
+// process, so the effective limit scales with the number of replicas.
+func rateLimit(limit RateLimit) gin.HandlerFunc {
+	var (
+		mu        sync.Mutex
+		clients   = map[string]*rateClient{}
+		lastSweep = time.Now()
+	)
+	interval := limit.Per / time.Duration(limit.Requests)
+	retryAfter := strconv.Itoa(int(math.Ceil(interval.Seconds())))
+
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := c.ClientIP()
+
+		mu.Lock()
+		// a client idle for a whole period is back to a full bucket, so forget it
+		if now.Sub(lastSweep) > limit.Per {
+			for key, cl := range clients {
+				if now.Sub(cl.lastSeen) > limit.Per {
+					delete(clients, key)
+				}
+			}
+			lastSweep = now
+		}
+		cl, ok := clients[ip]
+		if !ok {
+			cl = &rateClient{limiter: rate.NewLimiter(rate.Every(interval), limit.Requests)}
+			clients[ip] = cl
+		}
+		cl.lastSeen = now
+		allowed := cl.limiter.AllowN(now, 1)
+		mu.Unlock()
+
+		if !allowed {
+			c.Header("Retry-After", retryAfter)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": true, "message": constant.TooManyRequestsError})
+			return
+		}
+		c.Next()
+	}
+}
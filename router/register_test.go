@@ -0,0 +1,56 @@
+package router
+
+import (
+	"ecommerce-project/config"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterRejectsInvalidRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) {}
+
+	for name, route := range map[string]Route{
+		"method":     {Name: "Bad", Method: "FETCH", Pattern: "/bad", HandlerFunc: ok},
+		"handler":    {Name: "Bad", Method: http.MethodGet, Pattern: "/bad"},
+		"rate limit": {Name: "Bad", Method: http.MethodGet, Pattern: "/bad", HandlerFunc: ok, RateLimit: RateLimit{Key: "bad", Requests: 5}},
+		"limit key":  {Name: "Bad", Method: http.MethodGet, Pattern: "/bad", HandlerFunc: ok, RateLimit: RateLimit{Requests: 5, Per: time.Minute}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := register(gin.New(), config.Default(), rateLimiters{}, RouteGroup{Prefix: "/api", Routes: Routes{route}})
+			if err == nil || !strings.Contains(err.Error(), "/api/bad") {
+				t.Fatalf("got %v, want an error naming the route", err)
+			}
+		})
+	}
+}
+
+func TestRegisterRejectsConflictingRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) {}
+
+	err := register(gin.New(), config.Default(), rateLimiters{}, RouteGroup{Routes: Routes{
+		{Name: "First", Method: http.MethodGet, Pattern: "/users/:id", HandlerFunc: ok},
+		{Name: "Second", Method: http.MethodGet, Pattern: "/users/:email", HandlerFunc: ok},
+	}})
+	if err == nil {
+		t.Fatal("conflicting wildcards registered")
+	}
+}
+
+func TestRegisterRejectsOneKeyWithTwoLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) {}
+
+	err := register(gin.New(), config.Default(), rateLimiters{}, RouteGroup{Routes: Routes{
+		{Name: "First", Method: http.MethodPost, Pattern: "/login", HandlerFunc: ok, RateLimit: RateLimit{Key: "login", Requests: 10, Per: time.Minute}},
+		{Name: "Second", Method: http.MethodPost, Pattern: "/signin", HandlerFunc: ok, RateLimit: RateLimit{Key: "login", Requests: 5, Per: time.Minute}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "/signin") {
+		t.Fatalf("got %v, want an error naming the second route", err)
+	}
+}
@@ -2,154 +2,211 @@ package router
 
 import (
 	"ecommerce-project/auth"
-	"log"
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/logging"
+	"ecommerce-project/metrics"
+	"ecommerce-project/openapi"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// RateLimit caps how many requests one client IP may make to a route. Routes
+// with the same Key share the budget.
+type RateLimit struct {
+	Key      string
+	Requests int
+	Per      time.Duration
+}
+
+// Route declares an endpoint and everything that guards it; register turns the
+// declaration into a gin handler chain.
 type Route struct {
 	Name        string
 	Method      string
 	Pattern     string
-	HandlerFunc func(*gin.Context)
-}
-type routes struct {
-	router *gin.Engine
+	HandlerFunc gin.HandlerFunc
+	// Auth requires a valid bearer token.
+	Auth bool
+	// Roles restricts the route to these user types and implies Auth.
+	Roles []string
+	// AllowPasswordChange admits tokens of users who must change their password,
+	// which every other secured route rejects.
+	AllowPasswordChange bool
+	// RateLimit throttles each client IP; the zero value means unlimited.
+	RateLimit RateLimit
+	// Middleware runs after authentication, just before HandlerFunc.
+	Middleware []gin.HandlerFunc
+	// Request and Response are zero values of the types the handler binds and
+	// returns on success; they only feed the OpenAPI document and may be nil.
+	Request  interface{}
+	Response interface{}
 }
 
 type Routes []Route
 
-func (r routes) EcommerceUser(rg *gin.RouterGroup) {
-	orderRouteGrouping := rg.Group("/ecommerce")
-	orderRouteGrouping.Use(CORSEMiddleware())
-	for _, route := range userRoutes {
-		switch route.Method {
-			case "GET":
-				orderRouteGrouping.GET(route.Pattern, route.HandlerFunc)
-			case "POST":
-				orderRouteGrouping.POST(route.Pattern, route.HandlerFunc)
-			case "OPTIONS":
-				orderRouteGrouping.OPTIONS(route.Pattern, route.HandlerFunc)
-			case "PUT":
-				orderRouteGrouping.PUT(route.Pattern, route.HandlerFunc)
-			case "DELETE":
-				orderRouteGrouping.DELETE(route.Pattern, route.HandlerFunc)
-			default:
-				orderRouteGrouping.GET(route.Pattern, func(c *gin.Context) {
-					c.JSON(200, gin.H{
-						"result": "Specify a valid http method with this route.",
-					})
-				})
-		}
-	}
+// RouteGroup mounts Routes under Prefix. Its Middleware runs before each route's own chain.
+type RouteGroup struct {
+	Prefix     string
+	Routes     Routes
+	Middleware []gin.HandlerFunc
+	// Deprecated marks the whole group as deprecated in the OpenAPI document.
+	Deprecated bool
+}
+
+// methods are the HTTP methods a Route may declare.
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
 }
 
+// secured reports whether the route needs a bearer token.
+func (route Route) secured() bool {
+	return route.Auth || len(route.Roles) > 0
+}
 
-func (r routes) EcommerceProduct(rg *gin.RouterGroup) {
-	orderRouteGrouping := rg.Group("/ecommerce")
-	orderRouteGrouping.Use(CORSEMiddleware())
-	for _, route := range productRoutes {
-		switch route.Method {
-			case "GET":
-				orderRouteGrouping.GET(route.Pattern, route.HandlerFunc)
-			case "POST":
-				orderRouteGrouping.POST(route.Pattern, route.HandlerFunc)
-			case "OPTIONS":
-				orderRouteGrouping.OPTIONS(route.Pattern, route.HandlerFunc)
-			case "PUT":
-				orderRouteGrouping.PUT(route.Pattern, route.HandlerFunc)
-			case "DELETE":
-				orderRouteGrouping.DELETE(route.Pattern, route.HandlerFunc)
-			default:
-				orderRouteGrouping.GET(route.Pattern, func(c *gin.Context) {
-					c.JSON(200, gin.H{
-						"result": "Specify a valid http method with this route.",
-					})
-				})
+// handlers builds the chain gin runs for the route: rate limit, authentication,
+// the pending password change check, role check, the route's middleware and
+// finally its handler. The rate limit comes from limiters.
+func (route Route) handlers(cfg *config.Config, limiters rateLimiters) ([]gin.HandlerFunc, error) {
+	if !slices.Contains(methods, route.Method) {
+		return nil, fmt.Errorf("invalid method %q", route.Method)
+	}
+	if route.HandlerFunc == nil {
+		return nil, errors.New("no handler")
+	}
+	if route.RateLimit.Requests < 0 || (route.RateLimit.Requests > 0 && (route.RateLimit.Per <= 0 || route.RateLimit.Key == "")) {
+		return nil, fmt.Errorf("invalid rate limit %+v", route.RateLimit)
+	}
+
+	var chain []gin.HandlerFunc
+	if route.RateLimit.Requests > 0 {
+		limiter, err := limiters.get(route.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, limiter)
+	}
+	if route.secured() {
+		chain = append(chain, auth.Auth(cfg.Auth))
+		if !route.AllowPasswordChange {
+			chain = append(chain, auth.RequirePasswordChanged())
 		}
 	}
+	if len(route.Roles) > 0 {
+		chain = append(chain, auth.RequireRoles(route.Roles...))
+	}
+	chain = append(chain, route.Middleware...)
+	return append(chain, route.HandlerFunc), nil
 }
 
-func (r routes) EcommerceGlobalProductRoutes(rg *gin.RouterGroup) {
-	orderRouteGrouping := rg.Group("/ecommerce-product")
-	orderRouteGrouping.Use(CORSEMiddleware())
-	for _, route := range productGlobalRoutes {
-		switch route.Method {
-			case "GET":
-				orderRouteGrouping.GET(route.Pattern, route.HandlerFunc)
-			case "POST":
-				orderRouteGrouping.POST(route.Pattern, route.HandlerFunc)
-			case "OPTIONS":
-				orderRouteGrouping.OPTIONS(route.Pattern, route.HandlerFunc)
-			case "PUT":
-				orderRouteGrouping.PUT(route.Pattern, route.HandlerFunc)
-			case "DELETE":
-				orderRouteGrouping.DELETE(route.Pattern, route.HandlerFunc)
-			default:
-				orderRouteGrouping.GET(route.Pattern, func(c *gin.Context) {
-					c.JSON(200, gin.H{
-						"result": "Specify a valid http method with this route.",
-					})
-				})
+// register adds every route in g to engine. It returns an error instead of
+// registering anything questionable, so a bad route table stops the server at startup.
+func register(engine *gin.Engine, cfg *config.Config, limiters rateLimiters, g RouteGroup) error {
+	group := engine.Group(g.Prefix, g.Middleware...)
+	for _, route := range g.Routes {
+		handlers, err := route.handlers(cfg, limiters)
+		if err != nil {
+			return fmt.Errorf("route %q (%s %s%s): %w", route.Name, route.Method, g.Prefix, route.Pattern, err)
+		}
+		if err := handle(group, route.Method, route.Pattern, handlers); err != nil {
+			return fmt.Errorf("route %q (%s %s%s): %w", route.Name, route.Method, g.Prefix, route.Pattern, err)
 		}
 	}
+	return nil
 }
 
-func (r routes) EcommerceAuthUser(rg *gin.RouterGroup) {
-	orderRouteGrouping := rg.Group("/ecommerce")
-	orderRouteGrouping.Use(CORSEMiddleware())
-	for _, route := range userAuthRoutes {
-		switch route.Method {
-			case "GET":
-				orderRouteGrouping.GET(route.Pattern, route.HandlerFunc)
-			case "POST":
-				orderRouteGrouping.POST(route.Pattern, route.HandlerFunc)
-			case "OPTIONS":
-				orderRouteGrouping.OPTIONS(route.Pattern, route.HandlerFunc)
-			case "PUT":
-				orderRouteGrouping.PUT(route.Pattern, route.HandlerFunc)
-			case "DELETE":
-				orderRouteGrouping.DELETE(route.Pattern, route.HandlerFunc)
-			default:
-				orderRouteGrouping.GET(route.Pattern, func(c *gin.Context) {
-					c.JSON(200, gin.H{
-						"result": "Specify a valid http method with this route.",
-					})
-				})
+// handle registers a route, turning gin's panic on a conflicting path into an error.
+func handle(group *gin.RouterGroup, method, pattern string, handlers []gin.HandlerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
 		}
-	}
+	}()
+	group.Handle(method, pattern, handlers...)
+	return nil
 }
 
-// append routes with versions
-func ClientRoutes() {
-	r := routes{
-		router: gin.Default(),
+// NewRouter builds the gin engine with every route group registered.
+// It does not start listening, so tests can drive it through httptest.
+func NewRouter(cfg *config.Config) (*gin.Engine, error) {
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	engine.Use(
+		otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(traced)),
+		logging.Middleware(), logging.Recovery(), metrics.Middleware(), cors(cfg.CORS), cfg.Middleware(),
+	)
+	engine.GET(constant.MetricsRoute, gin.WrapH(metrics.Handler()))
+	engine.GET(constant.OpenAPIRoute, openapi.SpecHandler(apiSpec(cfg)))
+	engine.GET(constant.DocsRoute, openapi.DocsHandler(constant.OpenAPIRoute, constant.DocsAssetsPrefix))
+	engine.GET(constant.DocsAssetsPrefix+"/*filepath", openapi.AssetsHandler())
+	if cfg.Storage.Driver == config.LocalStorage {
+		// uploaded files; an S3 bucket serves its own
+		engine.Static(cfg.Storage.Local.URLPrefix, cfg.Storage.Local.Dir)
 	}
 
-	v1 := r.router.Group(os.Getenv("API_VERSION"))
-	r.EcommerceUser(v1)
-	r.EcommerceGlobalProductRoutes(v1)
+	limiters := rateLimiters{}
+	for _, g := range routeGroups(cfg) {
+		if err := register(engine, cfg, limiters, g); err != nil {
+			return nil, err
+		}
+	}
+	return engine, nil
+}
 
-	v1.Use(auth.Auth())
-	r.EcommerceProduct(v1)
-	r.EcommerceAuthUser(v1)
+// deprecationDate is when the legacy routes were superseded by the v1 routes.
+var deprecationDate = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
 
-	if err := r.router.Run(":" + os.Getenv("PORT")); err != nil {
-		log.Printf("Failed to run server: %v", err)
+// deprecated marks responses from the legacy routes mounted under prefix with a
+// Deprecation header (RFC 9745) and links to the v1 route replacing each one.
+func deprecated(prefix string) gin.HandlerFunc {
+	prefix = strings.TrimSuffix(prefix, "/")
+	value := fmt.Sprintf("@%d", deprecationDate.Unix())
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", value)
+		key := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), prefix)
+		if successor, ok := legacySuccessors[key]; ok {
+			for _, p := range c.Params {
+				successor = strings.Replace(successor, ":"+p.Key, url.PathEscape(p.Value), 1)
+			}
+			c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		c.Next()
 	}
 }
 
-// Middlewares
-func CORSEMiddleware() gin.HandlerFunc {
-	return func (c *gin.Context){
-		c.Writer.Header().Set("Content-type", "application/json")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+// traced keeps probe and metrics scrapes out of the traces.
+func traced(req *http.Request) bool {
+	switch req.URL.Path {
+	case constant.HealthCheckRoute, constant.ReadinessRoute, constant.MetricsRoute, constant.OpenAPIRoute:
+		return false
+	}
+	return true
+}
 
-		if c.Request.Method == "OPTIONS"{
-			c.Status(http.StatusOK)
-		}
+// NewServer wraps the router in an http.Server using the configured port and timeouts.
+func NewServer(cfg *config.Config) (*http.Server, error) {
+	handler, err := NewRouter(cfg)
+	if err != nil {
+		return nil, err
 	}
-}
\ No newline at end of file
+	return &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}, nil
+}
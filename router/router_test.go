@@ -0,0 +1,1373 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-project/auth"
+	"ecommerce-project/config"
+	"ecommerce-project/constant"
+	"ecommerce-project/database"
+	"ecommerce-project/helper"
+	"ecommerce-project/imaging/imagingtest"
+	"ecommerce-project/password"
+	"ecommerce-project/router"
+	"ecommerce-project/storage"
+	"ecommerce-project/types"
+	"encoding/json"
+	"errors"
+	"image"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testAdminEmail    = "admin@test.local"
+	testAdminPassword = "admin-password"
+)
+
+// fakeMailer captures OTPs instead of sending them.
+type fakeMailer struct {
+	mu       sync.Mutex
+	next     int64
+	otps     map[string]int64
+	notices  []string
+	readyErr error
+}
+
+func (f *fakeMailer) Ready() error {
+	return f.readyErr
+}
+
+func (f *fakeMailer) SendOtp(_ context.Context, req types.Verification) (types.Verification, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	req.Otp = 1000 + f.next
+	f.otps[req.Email] = req.Otp
+	return req, nil
+}
+
+func (f *fakeMailer) NotifyEmailChanged(_ context.Context, oldEmail, newEmail string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.notices = append(f.notices, oldEmail+" -> "+newEmail)
+	return nil
+}
+
+func (f *fakeMailer) otp(email string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.otps[email]
+}
+
+// harness is an API instance backed by the in-memory database.
+type harness struct {
+	t      *testing.T
+	engine *gin.Engine
+	mailer *fakeMailer
+}
+
+type response struct {
+	Code   int
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// newHarness resets the database and mailer, seeds fixtures and builds the router.
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.LegacyPrefix = "/api/v1"
+	cfg.Database.Driver = config.MemoryDriver
+	cfg.Auth.JwtSecret = "test-secret"
+	cfg.Auth.JwtIssuer = "test"
+	cfg.Storage.Local.Dir = t.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("test config: %v", err)
+	}
+
+	if err := database.Connect(cfg.Database); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := database.Mgr.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	mailer := &fakeMailer{otps: map[string]int64{}}
+	previous := helper.Mailer
+	helper.Mailer = mailer
+	t.Cleanup(func() { helper.Mailer = previous })
+	usePasswordPolicy(t, cfg.Password)
+	previousFiles := storage.Files
+	storage.Files = storage.NewLocal(cfg.Storage.Local)
+	t.Cleanup(func() { storage.Files = previousFiles })
+
+	engine, err := router.NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("router: %v", err)
+	}
+	h := &harness{t: t, engine: engine, mailer: mailer}
+	h.seed()
+	return h
+}
+
+// usePasswordPolicy installs a password manager for cfg, at bcrypt's minimum
+// cost so the tests don't spend their time hashing.
+func usePasswordPolicy(t *testing.T, cfg config.Password) {
+	t.Helper()
+
+	cfg.BcryptCost = bcrypt.MinCost
+	m, err := password.New(cfg)
+	if err != nil {
+		t.Fatalf("password manager: %v", err)
+	}
+	previous := password.Mgr
+	password.Mgr = m
+	t.Cleanup(func() { password.Mgr = previous })
+}
+
+func (h *harness) hash(plain string) string {
+	h.t.Helper()
+
+	hash, err := password.Mgr.Hash(plain)
+	if err != nil {
+		h.t.Fatalf("hash: %v", err)
+	}
+	return hash
+}
+
+// seed inserts an admin account and a couple of products.
+func (h *harness) seed() {
+	h.t.Helper()
+
+	admin := types.User{
+		Name:     "Admin",
+		Email:    testAdminEmail,
+		Password: h.hash(testAdminPassword),
+		UserType: constant.AdminUser,
+	}
+	if _, err := database.Mgr.Insert(context.Background(), admin, constant.UserCollection); err != nil {
+		h.t.Fatalf("seed admin: %v", err)
+	}
+
+	for _, p := range []types.Product{
+		{Name: "Blue Kettle", Description: "Electric kettle", Price: 25, ImageUrl: "kettle.png"},
+		{Name: "Desk Lamp", Description: "LED lamp for the desk", Price: 40, ImageUrl: "lamp.png"},
+	} {
+		p.CreatedAt = time.Now().Unix()
+		p.UpdatedAt = p.CreatedAt
+		if _, err := database.Mgr.Insert(context.Background(), p, constant.ProductCollection); err != nil {
+			h.t.Fatalf("seed product: %v", err)
+		}
+	}
+}
+
+// do sends a JSON request to the versioned API and decodes the JSON response.
+func (h *harness) do(method, path, token string, body interface{}) response {
+	h.t.Helper()
+
+	return h.doURL(method, constant.APIPrefix+path, token, body)
+}
+
+// doURL is do for a path outside the API version prefix.
+func (h *harness) doURL(method, path, token string, body interface{}) response {
+	h.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			h.t.Fatalf("encode body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, req)
+
+	resp := response{Code: rec.Code, Header: rec.Header()}
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp.Body); err != nil {
+			h.t.Fatalf("%s %s: decode response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return resp
+}
+
+// mustDo is do that fails the test unless the response status is want.
+func (h *harness) mustDo(want int, method, path, token string, body interface{}) response {
+	h.t.Helper()
+
+	resp := h.do(method, path, token, body)
+	if resp.Code != want {
+		h.t.Fatalf("%s %s: status %d, want %d: %v", method, path, resp.Code, want, resp.Body)
+	}
+	return resp
+}
+
+// mustDoURL is doURL for a bodiless request that fails the test unless the status is want.
+func (h *harness) mustDoURL(want int, method, path string) response {
+	h.t.Helper()
+
+	resp := h.doURL(method, path, "", nil)
+	if resp.Code != want {
+		h.t.Fatalf("%s %s: status %d, want %d: %v", method, path, resp.Code, want, resp.Body)
+	}
+	return resp
+}
+
+// login returns a token for the given credentials.
+func (h *harness) login(email, password string) string {
+	h.t.Helper()
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/auth/login", "", types.Login{Email: email, Password: password})
+	token, _ := resp.Body["token"].(string)
+	if token == "" {
+		h.t.Fatalf("login %s: no token in %v", email, resp.Body)
+	}
+	return token
+}
+
+// signUp runs verify-email, verify-otp and register for a new user and returns its token.
+func (h *harness) signUp(email, password string) string {
+	h.t.Helper()
+
+	h.mustDo(http.StatusOK, http.MethodPost, "/auth/verify-email", "", map[string]string{"email": email})
+
+	otp := h.mailer.otp(email)
+	if otp == 0 {
+		h.t.Fatalf("no OTP captured for %s", email)
+	}
+	h.mustDo(http.StatusOK, http.MethodPost, "/auth/verify-otp", "", map[string]interface{}{"email": email, "otp": otp})
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/users", "", types.UserClient{
+		Name:     "Shopper",
+		Email:    email,
+		Phone:    "5550100",
+		Password: password,
+	})
+	token, _ := resp.Body["token"].(string)
+	if token == "" {
+		h.t.Fatalf("register %s: no token in %v", email, resp.Body)
+	}
+	return token
+}
+
+// products lists the products currently in the catalogue.
+func (h *harness) products() []interface{} {
+	h.t.Helper()
+
+	resp := h.mustDo(http.StatusOK, http.MethodGet, "/products?limit=50", "", nil)
+	data, _ := resp.Body["data"].(map[string]interface{})
+	products, _ := data["products"].([]interface{})
+	return products
+}
+
+func productID(p interface{}) string {
+	id, _ := p.(map[string]interface{})["_id"].(string)
+	return id
+}
+
+func TestUserJourney(t *testing.T) {
+	h := newHarness(t)
+	const email, password = "shopper@test.local", "shopper-password"
+
+	h.signUp(email, password)
+
+	// registering twice with the same email is rejected
+	resp := h.do(http.MethodPost, "/users", "", types.UserClient{
+		Name: "Again", Email: email, Phone: "1", Password: password,
+	})
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("duplicate register: status %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+
+	token := h.login(email, password)
+
+	products := h.products()
+	if len(products) != 2 {
+		t.Fatalf("got %d products, want 2", len(products))
+	}
+	productId := productID(products[0])
+
+	// a cart needs a shipping address first
+	resp = h.do(http.MethodPost, "/cart", token, types.CartClient{ProductID: productId})
+	if resp.Code == http.StatusOK {
+		t.Fatalf("add to cart without address succeeded")
+	}
+
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{
+		Address1: "1 Main St", City: "Springfield", Country: "US",
+	})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: productId})
+
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	h.mustDo(http.StatusOK, http.MethodPost, "/orders", token, nil)
+
+	carts, err := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	if err != nil {
+		t.Fatalf("list carts: %v", err)
+	}
+	if len(carts) != 1 {
+		t.Fatalf("got %d cart lines, want 1", len(carts))
+	}
+	if !carts[0].Checkout {
+		t.Errorf("cart line not checked out")
+	}
+	if carts[0].ProductID.Hex() != productId {
+		t.Errorf("cart product %s, want %s", carts[0].ProductID.Hex(), productId)
+	}
+}
+
+func TestVerifyOtpRejectsWrongCode(t *testing.T) {
+	h := newHarness(t)
+	const email = "wrong-otp@test.local"
+
+	h.mustDo(http.StatusOK, http.MethodPost, "/auth/verify-email", "", map[string]string{"email": email})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/auth/verify-otp", "", map[string]interface{}{"email": email, "otp": h.mailer.otp(email) + 1})
+
+	// registration stays blocked until the email is verified
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/users", "", types.UserClient{
+		Name: "Shopper", Email: email, Phone: "1", Password: "password",
+	})
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	h := newHarness(t)
+
+	h.mustDo(http.StatusUnauthorized, http.MethodPost, "/cart", "", types.CartClient{})
+	h.mustDo(http.StatusUnauthorized, http.MethodPost, "/products", "not-a-token", types.ProductClient{})
+}
+
+func TestAdminProductCRUD(t *testing.T) {
+	h := newHarness(t)
+	token := h.login(testAdminEmail, testAdminPassword)
+
+	// image_url is optional, since uploads fill the gallery
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/products", token, types.ProductClient{
+		Name: "Red Mug", Description: "Ceramic mug", Price: 9.5,
+	})
+	data, _ := resp.Body["data"].(map[string]interface{})
+	id, _ := data["_id"].(string)
+	if id == "" {
+		t.Fatalf("register product: no id in %v", resp.Body)
+	}
+
+	resp = h.mustDo(http.StatusOK, http.MethodGet, "/products?search=mug", "", nil)
+	data, _ = resp.Body["data"].(map[string]interface{})
+	if found, _ := data["products"].([]interface{}); len(found) != 1 || productID(found[0]) != id {
+		t.Fatalf("search mug: got %v", data["products"])
+	}
+
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+id, token, types.UpdateProduct{Price: 12})
+
+	objId, _ := primitive.ObjectIDFromHex(id)
+	product, err := database.Mgr.GetSingleProductById(context.Background(), objId, constant.ProductCollection)
+	if err != nil {
+		t.Fatalf("get product: %v", err)
+	}
+	if product.Price != 12 || product.Name != "Red Mug" {
+		t.Errorf("updated product = %+v", product)
+	}
+
+	h.mustDo(http.StatusOK, http.MethodDelete, "/products/"+id, token, nil)
+	if got := len(h.products()); got != 2 {
+		t.Errorf("got %d products after delete, want 2", got)
+	}
+}
+
+func TestProductAdminOnly(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("plain@test.local", "plain-password")
+
+	resp := h.do(http.MethodPost, "/products", token, types.ProductClient{
+		Name: "Nope", Description: "Nope", Price: 1, ImageUrl: "nope.png",
+	})
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("non-admin create: got %d, want 403", resp.Code)
+	}
+	if got := len(h.products()); got != 2 {
+		t.Errorf("got %d products, want 2", got)
+	}
+}
+
+func TestLoginIsRateLimited(t *testing.T) {
+	h := newHarness(t)
+	wrong := types.Login{Email: testAdminEmail, Password: "wrong-password"}
+
+	legacyLogin := "/api/v1" + constant.LegacyGroup + constant.UserLoginRoute
+
+	// the v1 route and its legacy alias share one budget
+	for i := 0; i < 10; i++ {
+		var resp response
+		if i%2 == 0 {
+			resp = h.do(http.MethodPost, constant.AuthLoginRoute, "", wrong)
+		} else {
+			resp = h.doURL(http.MethodPost, legacyLogin, "", wrong)
+		}
+		if resp.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d was rate limited", i+1)
+		}
+	}
+	resp := h.mustDo(http.StatusTooManyRequests, http.MethodPost, constant.AuthLoginRoute, "", wrong)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	if resp := h.doURL(http.MethodPost, legacyLogin, "", wrong); resp.Code != http.StatusTooManyRequests {
+		t.Errorf("legacy login after the budget ran out: status %d, want 429", resp.Code)
+	}
+
+	// other routes keep their own budget, even one with the same limit
+	h.mustDo(http.StatusOK, http.MethodGet, "/products", "", nil)
+	if resp := h.do(http.MethodPost, constant.AuthVerifyOtpRoute, "", types.Verification{Email: testAdminEmail, Otp: 1}); resp.Code == http.StatusTooManyRequests {
+		t.Error("otp verification shares the login budget")
+	}
+}
+
+// slowManager fails product listing as if the database missed its deadline.
+type slowManager struct {
+	database.Manager
+}
+
+func (slowManager) GetListProducts(ctx context.Context, page, limit, offset int, sort, collectionName string) ([]types.Product, int64, error) {
+	return nil, 0, context.DeadlineExceeded
+}
+
+func TestDatabaseTimeoutIsGatewayTimeout(t *testing.T) {
+	h := newHarness(t)
+	database.Mgr = slowManager{database.Mgr}
+
+	h.mustDo(http.StatusGatewayTimeout, http.MethodGet, "/products", "", nil)
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	h := newHarness(t)
+
+	h.mustDoURL(http.StatusOK, http.MethodGet, "/healthz")
+
+	resp := h.mustDoURL(http.StatusOK, http.MethodGet, "/readyz")
+	if resp.Body["status"] != "ok" {
+		t.Errorf("readyz status = %v", resp.Body)
+	}
+
+	h.mailer.readyErr = errors.New("no api key")
+	resp = h.mustDoURL(http.StatusServiceUnavailable, http.MethodGet, "/readyz")
+	checks, _ := resp.Body["checks"].(map[string]interface{})
+	email, _ := checks["email"].(map[string]interface{})
+	db, _ := checks["database"].(map[string]interface{})
+	if email["status"] != "unavailable" || db["status"] != "ok" {
+		t.Errorf("readyz checks = %v", checks)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	h := newHarness(t)
+
+	h.products()
+	h.signUp("metrics@test.local", "password-1")
+	h.do(http.MethodPost, "/auth/login", "", types.Login{Email: "metrics@test.local", Password: "wrong"})
+
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constant.MetricsRoute, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics: status %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`ecommerce_http_requests_total{method="GET",route="/api/v1/products",status="200"}`,
+		`ecommerce_http_request_duration_seconds_bucket{method="POST",route="/api/v1/users",status="200"`,
+		`ecommerce_db_operation_duration_seconds_count{collection="products",method="GetListProducts",outcome="ok"}`,
+		`ecommerce_registrations_total`,
+		`ecommerce_otps_sent_total`,
+		`ecommerce_logins_total{result="failure"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
+
+func TestRequestsAreTraced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	h := newHarness(t)
+	h.products()
+	h.mustDoURL(http.StatusOK, http.MethodGet, "/healthz")
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want one for the product list and none for the probe", len(spans))
+	}
+	if spans[0].Name != "/api/v1/products" || spans[0].SpanKind != trace.SpanKindServer {
+		t.Errorf("span = %s (%s), want the server span for the route", spans[0].Name, spans[0].SpanKind)
+	}
+}
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	h := newHarness(t)
+
+	resp := h.mustDoURL(http.StatusOK, http.MethodGet, constant.OpenAPIRoute)
+	if resp.Body["openapi"] != "3.0.3" {
+		t.Errorf("openapi version = %v", resp.Body["openapi"])
+	}
+	paths, _ := resp.Body["paths"].(map[string]interface{})
+
+	undocumented := map[string]bool{
+		constant.MetricsRoute: true, constant.OpenAPIRoute: true,
+		constant.DocsRoute: true, constant.DocsAssetsPrefix + "/*filepath": true,
+		config.Default().Storage.Local.URLPrefix + "/*filepath": true,
+	}
+	for _, route := range h.engine.Routes() {
+		if undocumented[route.Path] {
+			continue
+		}
+		path := route.Path
+		for _, part := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(part, ":") {
+				path = strings.Replace(path, part, "{"+part[1:]+"}", 1)
+			}
+		}
+		item, _ := paths[path].(map[string]interface{})
+		if item[strings.ToLower(route.Method)] == nil {
+			t.Errorf("%s %s is served but missing from the OpenAPI document", route.Method, route.Path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constant.DocsRoute, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), constant.OpenAPIRoute) {
+		t.Errorf("GET /docs: status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constant.DocsAssetsPrefix+"/swagger-ui-bundle.js", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("GET swagger-ui-bundle.js: status %d", rec.Code)
+	}
+}
+
+func TestGetUserAndProductByID(t *testing.T) {
+	h := newHarness(t)
+	token := h.login(testAdminEmail, testAdminPassword)
+
+	admin, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), testAdminEmail, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get admin: %v", err)
+	}
+	resp := h.mustDo(http.StatusOK, http.MethodGet, "/users/"+admin.Id.Hex(), token, nil)
+	if data, _ := resp.Body["data"].(map[string]interface{}); data["email"] != testAdminEmail {
+		t.Errorf("GET /users/:id data = %v", resp.Body["data"])
+	}
+	h.mustDo(http.StatusBadRequest, http.MethodGet, "/users/not-an-id", token, nil)
+
+	id := productID(h.products()[0])
+	resp = h.mustDo(http.StatusOK, http.MethodGet, "/products/"+id, "", nil)
+	if productID(resp.Body["data"]) != id {
+		t.Errorf("GET /products/:id data = %v", resp.Body["data"])
+	}
+	h.mustDo(http.StatusNotFound, http.MethodGet, "/products/"+primitive.NewObjectID().Hex(), "", nil)
+}
+
+func TestUserResponsesNeverCarryPasswords(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+
+	const email = "viewer@test.local"
+	token := h.signUp(email, "viewer-password")
+	viewer, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get viewer: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name, token, id string
+		want            []string
+	}{
+		{"self", token, viewer.Id.Hex(), []string{"_id", "name", "email", "phone", "created_at", "updated_at"}},
+		{"admin", adminToken, viewer.Id.Hex(), []string{"_id", "name", "email", "phone", "created_at", "updated_at", "user_type"}},
+	} {
+		resp := h.mustDo(http.StatusOK, http.MethodGet, "/users/"+tc.id, tc.token, nil)
+		if resp.Body["error"] != false {
+			t.Errorf("%s: error = %v, want false", tc.name, resp.Body["error"])
+		}
+		data, _ := resp.Body["data"].(map[string]interface{})
+		var got []string
+		for key := range data {
+			got = append(got, key)
+		}
+		sort.Strings(got)
+		sort.Strings(tc.want)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got fields %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	resp := h.mustDo(http.StatusOK, http.MethodPut, "/users/"+viewer.Id.Hex(), token, types.UserUpdateClient{Name: "Renamed"})
+	if data, _ := resp.Body["data"].(map[string]interface{}); resp.Body["error"] != false || data["name"] != "Renamed" || data["password"] != nil {
+		t.Errorf("PUT /users/:id body = %v", resp.Body)
+	}
+}
+
+func TestUsersCanOnlyActOnThemselves(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	token := h.signUp("first@test.local", "first-password")
+	h.signUp("second@test.local", "second-password")
+
+	second, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), "second@test.local", constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	path := "/users/" + second.Id.Hex()
+
+	h.mustDo(http.StatusForbidden, http.MethodGet, path, token, nil)
+	h.mustDo(http.StatusForbidden, http.MethodPut, path, token, types.UserUpdateClient{Name: "Hijacked"})
+	// the legacy route names the user in the body
+	legacy := h.doURL(http.MethodPut, "/api/v1"+constant.LegacyGroup+constant.UpdateUser, token, types.UserUpdateClient{Id: second.Id.Hex(), Name: "Hijacked"})
+	if legacy.Code != http.StatusForbidden {
+		t.Errorf("legacy update of another user: status %d, want 403", legacy.Code)
+	}
+
+	var audit bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&audit, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	h.mustDo(http.StatusOK, http.MethodPut, path, adminToken, types.UserUpdateClient{Name: "Renamed By Admin"})
+	if !strings.Contains(audit.String(), `"msg":"audit","action":"user.update"`) || !strings.Contains(audit.String(), second.Id.Hex()) {
+		t.Errorf("admin update not audited: %s", audit.String())
+	}
+
+	user, err := database.Mgr.GetSingleUserByUserId(context.Background(), second.Id, constant.UserCollection)
+	if err != nil || user.Name != "Renamed By Admin" {
+		t.Errorf("user after updates = %+v, %v", user, err)
+	}
+}
+
+func TestLoginUpgradesWeakHashes(t *testing.T) {
+	h := newHarness(t)
+
+	// the admin was seeded with bcrypt; switch the policy to argon2id
+	cfg := config.Default().Password
+	cfg.Algorithm = config.Argon2idAlgorithm
+	cfg.Argon2MemoryKiB = 64
+	usePasswordPolicy(t, cfg)
+
+	h.login(testAdminEmail, testAdminPassword)
+	admin, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), testAdminEmail, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get admin: %v", err)
+	}
+	if !strings.HasPrefix(admin.Password, "$argon2id$") {
+		t.Fatalf("hash not upgraded: %q", admin.Password)
+	}
+	h.login(testAdminEmail, testAdminPassword)
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/auth/login", "", types.Login{Email: testAdminEmail, Password: "wrong-password"})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	h := newHarness(t)
+	const email = "weak@test.local"
+
+	h.mustDo(http.StatusOK, http.MethodPost, "/auth/verify-email", "", map[string]string{"email": email})
+	h.mustDo(http.StatusOK, http.MethodPost, "/auth/verify-otp", "", map[string]interface{}{"email": email, "otp": h.mailer.otp(email)})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/users", "", types.UserClient{Name: "Weak", Email: email, Phone: "1", Password: "1234"})
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/users", "", types.UserClient{Name: "Weak", Email: email, Phone: "1", Password: "strong-enough"})
+	token, _ := resp.Body["token"].(string)
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	path := "/users/" + user.Id.Hex()
+	h.mustDo(http.StatusBadRequest, http.MethodPut, path, token, types.UserUpdateClient{Password: "short"})
+
+	// a changed password is stored hashed and works for login
+	h.mustDo(http.StatusOK, http.MethodPut, path, token, types.UserUpdateClient{Password: "changed-password"})
+	user, _ = database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if user.Password == "changed-password" {
+		t.Fatal("password stored in plain text")
+	}
+	h.login(email, "changed-password")
+}
+
+func TestBootstrapAdminMustChangePassword(t *testing.T) {
+	h := newHarness(t)
+	const email, initial = "ops@test.local", "initial-password"
+
+	// what the createadmin command inserts
+	id, err := database.Mgr.Insert(context.Background(), types.User{
+		Name: "Ops", Email: email, Password: h.hash(initial), UserType: constant.AdminUser, PasswordChangeRequired: true,
+	}, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("insert admin: %v", err)
+	}
+	path := "/users/" + id.(primitive.ObjectID).Hex()
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/auth/login", "", types.Login{Email: email, Password: initial})
+	if resp.Body["password_change_required"] != true {
+		t.Fatalf("login = %v, want password_change_required", resp.Body)
+	}
+	restricted := resp.Body["token"].(string)
+
+	h.mustDo(http.StatusForbidden, http.MethodGet, path, restricted, nil)
+	h.mustDo(http.StatusForbidden, http.MethodPost, "/products", restricted, types.ProductClient{Name: "X", Description: "X", Price: 1, ImageUrl: "x.png"})
+	h.mustDo(http.StatusForbidden, http.MethodPut, path, restricted, types.UserUpdateClient{Name: "Renamed"})
+	h.mustDo(http.StatusBadRequest, http.MethodPut, path, restricted, types.UserUpdateClient{Password: initial})
+	h.mustDo(http.StatusOK, http.MethodPut, path, restricted, types.UserUpdateClient{Password: "a-new-password"})
+
+	// the restricted token stays restricted; a fresh login isn't
+	h.mustDo(http.StatusForbidden, http.MethodGet, path, restricted, nil)
+	token := h.login(email, "a-new-password")
+	h.mustDo(http.StatusOK, http.MethodGet, path, token, nil)
+}
+
+func TestEmailChangeNeedsConfirmation(t *testing.T) {
+	h := newHarness(t)
+	const oldEmail, newEmail = "mover@test.local", "moved@test.local"
+	token := h.signUp(oldEmail, "mover-password")
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), oldEmail, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	path := "/users/" + user.Id.Hex()
+
+	h.mustDo(http.StatusBadRequest, http.MethodPut, path, token, types.UserUpdateClient{Email: newEmail})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email", token, types.EmailChangeClient{Email: oldEmail})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email", token, types.EmailChangeClient{Email: testAdminEmail})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email/verify", token, types.EmailChangeConfirmClient{Otp: 1})
+
+	h.mustDo(http.StatusOK, http.MethodPost, path+"/email", token, types.EmailChangeClient{Email: newEmail})
+	otp := h.mailer.otp(newEmail)
+	if otp == 0 {
+		t.Fatalf("no OTP sent to %s", newEmail)
+	}
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email", token, types.EmailChangeClient{Email: newEmail})
+	resp := h.mustDo(http.StatusOK, http.MethodGet, path, token, nil)
+	if data, _ := resp.Body["data"].(map[string]interface{}); data["email"] != oldEmail || data["pending_email"] != newEmail {
+		t.Errorf("user while pending = %v", data)
+	}
+
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email/verify", token, types.EmailChangeConfirmClient{Otp: otp + 1})
+	resp = h.mustDo(http.StatusOK, http.MethodPost, path+"/email/verify", token, types.EmailChangeConfirmClient{Otp: otp})
+	if data, _ := resp.Body["data"].(map[string]interface{}); data["email"] != newEmail || data["pending_email"] != nil {
+		t.Errorf("confirm data = %v", data)
+	}
+	if fresh, _ := resp.Body["token"].(string); fresh == "" {
+		t.Errorf("confirm returned no token: %v", resp.Body)
+	}
+	if want := []string{oldEmail + " -> " + newEmail}; !slices.Equal(h.mailer.notices, want) {
+		t.Errorf("notices = %v, want %v", h.mailer.notices, want)
+	}
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/email/verify", token, types.EmailChangeConfirmClient{Otp: otp})
+
+	h.login(newEmail, "mover-password")
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/auth/login", "", types.Login{Email: oldEmail, Password: "mover-password"})
+
+	// a profile update writes only the fields it changes
+	name := "Mover"
+	if err := database.Mgr.UpdateUser(context.Background(), user.Id, types.UserChanges{Name: &name}, constant.UserCollection); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	moved, _ := database.Mgr.GetSingleUserByUserId(context.Background(), user.Id, constant.UserCollection)
+	if moved.Name != name || moved.Email != newEmail || moved.Password != user.Password || moved.UserType != user.UserType {
+		t.Errorf("user after a name update = %+v", moved)
+	}
+}
+
+func TestAdminsCannotChangeOthersEmail(t *testing.T) {
+	h := newHarness(t)
+	const email, adminInbox = "target@test.local", "inbox@test.local"
+	token := h.signUp(email, "target-password")
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	path := "/users/" + user.Id.Hex() + "/email"
+
+	h.mustDo(http.StatusForbidden, http.MethodPost, path, adminToken, types.EmailChangeClient{Email: adminInbox})
+	if otp := h.mailer.otp(adminInbox); otp != 0 {
+		t.Errorf("OTP %d sent to %s on the admin's request", otp, adminInbox)
+	}
+
+	// even with a change pending, only the owner may confirm it
+	h.mustDo(http.StatusOK, http.MethodPost, path, token, types.EmailChangeClient{Email: adminInbox})
+	resp := h.mustDo(http.StatusForbidden, http.MethodPost, path+"/verify", adminToken, types.EmailChangeConfirmClient{Otp: h.mailer.otp(adminInbox)})
+	if resp.Body["token"] != nil {
+		t.Errorf("forbidden confirm returned a token: %v", resp.Body)
+	}
+	if stored, _ := database.Mgr.GetSingleUserByUserId(context.Background(), user.Id, constant.UserCollection); stored.Email != email {
+		t.Errorf("email = %q, want it unchanged", stored.Email)
+	}
+}
+
+func TestTokensIdentifyTheUserByID(t *testing.T) {
+	h := newHarness(t)
+	const email = "holder@test.local"
+	token := h.signUp(email, "holder-password")
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	// a token issued before an email change still acts as the same user
+	h.mustDo(http.StatusOK, http.MethodPost, "/users/"+user.Id.Hex()+"/email", token, types.EmailChangeClient{Email: "renamed@test.local"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/users/"+user.Id.Hex()+"/email/verify", token, types.EmailChangeConfirmClient{Otp: h.mailer.otp("renamed@test.local")})
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: productID(h.products()[0])})
+	carts, err := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	if err != nil || len(carts) != 1 {
+		t.Fatalf("carts = %v, %v; want the line added with the old token", carts, err)
+	}
+
+	// the role comes from the account, not the token
+	product := types.ProductClient{Name: "Tea Pot", Description: "Ceramic", Price: 30, ImageUrl: "pot.png"}
+	h.mustDo(http.StatusForbidden, http.MethodPost, "/products", token, product)
+	admin := constant.AdminUser
+	if err := database.Mgr.UpdateUser(context.Background(), user.Id, types.UserChanges{UserType: &admin}, constant.UserCollection); err != nil {
+		t.Fatalf("promote user: %v", err)
+	}
+	auth.Forget(user.Id)
+	h.mustDo(http.StatusOK, http.MethodPost, "/products", token, product)
+
+	// a token for an account that doesn't exist is rejected
+	wrapper := auth.JwtWrapper{SecretKey: "test-secret", Issuer: "test", ExpirationTime: 1}
+	orphan, err := wrapper.GenrateToken(primitive.NewObjectID(), email, constant.AdminUser, false)
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	h.mustDo(http.StatusUnauthorized, http.MethodGet, "/users/"+user.Id.Hex(), orphan, nil)
+}
+
+// buyAndReceive has the user behind token buy a product, and the admin mark the order delivered.
+func (h *harness) buyAndReceive(token, adminToken, email, productId string) {
+	h.t.Helper()
+
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: productId})
+	h.mustDo(http.StatusOK, http.MethodPost, "/orders", token, nil)
+
+	user, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+	if err != nil {
+		h.t.Fatalf("get user: %v", err)
+	}
+	carts, err := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	if err != nil {
+		h.t.Fatalf("list carts: %v", err)
+	}
+	for _, cart := range carts {
+		h.mustDo(http.StatusOK, http.MethodPost, "/orders/"+cart.Id.Hex()+"/delivered", adminToken, nil)
+	}
+}
+
+func TestProductReviews(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	productId := productID(h.products()[1])
+	reviews := "/products/" + productId + "/reviews"
+
+	first := h.signUp("first@test.local", "first-password")
+	h.mustDo(http.StatusForbidden, http.MethodPut, reviews, first, types.ReviewClient{Rating: 5})
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", first, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", first, types.CartClient{ProductID: productId})
+	h.mustDo(http.StatusOK, http.MethodPost, "/orders", first, nil)
+	// checked out but not delivered yet
+	h.mustDo(http.StatusForbidden, http.MethodPut, reviews, first, types.ReviewClient{Rating: 5})
+
+	user, _ := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), "first@test.local", constant.UserCollection)
+	carts, _ := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	delivered := "/orders/" + carts[0].Id.Hex() + "/delivered"
+	h.mustDo(http.StatusForbidden, http.MethodPost, delivered, first, nil)
+	h.mustDo(http.StatusOK, http.MethodPost, delivered, adminToken, nil)
+
+	h.mustDo(http.StatusBadRequest, http.MethodPut, reviews, first, types.ReviewClient{Rating: 6})
+	created := h.mustDo(http.StatusOK, http.MethodPut, reviews, first, types.ReviewClient{Rating: 4, Text: "Bright"})
+	edited := h.mustDo(http.StatusOK, http.MethodPut, reviews, first, types.ReviewClient{Rating: 2, Text: "Flickers"})
+	createdData, _ := created.Body["data"].(map[string]interface{})
+	editedData, _ := edited.Body["data"].(map[string]interface{})
+	if createdData["_id"] != editedData["_id"] || editedData["rating"] != float64(2) || editedData["user_id"] != nil {
+		t.Errorf("edited review = %v, want the same review with rating 2 and no user_id", editedData)
+	}
+
+	second := h.signUp("second@test.local", "second-password")
+	h.buyAndReceive(second, adminToken, "second@test.local", productId)
+	resp := h.mustDo(http.StatusOK, http.MethodPut, reviews, second, types.ReviewClient{Rating: 5, Text: "Great"})
+	secondReview, _ := resp.Body["data"].(map[string]interface{})["_id"].(string)
+
+	rating := func() (float64, float64) {
+		t.Helper()
+		product := h.mustDo(http.StatusOK, http.MethodGet, "/products/"+productId, "", nil).Body["data"].(map[string]interface{})
+		return product["rating_average"].(float64), product["rating_count"].(float64)
+	}
+	if avg, n := rating(); avg != 3.5 || n != 2 {
+		t.Errorf("rating = %v over %v, want 3.5 over 2", avg, n)
+	}
+
+	// product updates leave the rating alone, and it can be sorted on
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+productId, adminToken, types.UpdateProduct{Price: 45})
+	if avg, n := rating(); avg != 3.5 || n != 2 {
+		t.Errorf("rating after product update = %v over %v", avg, n)
+	}
+	list := h.mustDo(http.StatusOK, http.MethodGet, "/products?sort=rating", "", nil).Body["data"].(map[string]interface{})["products"].([]interface{})
+	if productID(list[0]) != productId {
+		t.Errorf("best rated product = %v, want %s first", list[0], productId)
+	}
+	h.mustDo(http.StatusBadRequest, http.MethodGet, "/products?sort=price", "", nil)
+
+	// hidden reviews drop out of the listing and the rating
+	moderate := "/reviews/" + secondReview + "/moderation"
+	h.mustDo(http.StatusForbidden, http.MethodPut, moderate, first, types.ReviewModeration{Hidden: true})
+	h.mustDo(http.StatusOK, http.MethodPut, moderate, adminToken, types.ReviewModeration{Hidden: true, Reason: "spam"})
+	if avg, n := rating(); avg != 2 || n != 1 {
+		t.Errorf("rating after hiding = %v over %v, want 2 over 1", avg, n)
+	}
+	listed := h.mustDo(http.StatusOK, http.MethodGet, reviews, "", nil).Body["data"].(map[string]interface{})
+	if listed["totalcount"] != float64(1) || len(listed["reviews"].([]interface{})) != 1 {
+		t.Errorf("listed reviews = %v, want only the visible one", listed)
+	}
+	h.mustDo(http.StatusOK, http.MethodPut, moderate, adminToken, types.ReviewModeration{Hidden: false})
+	if avg, n := rating(); avg != 3.5 || n != 2 {
+		t.Errorf("rating after restoring = %v over %v", avg, n)
+	}
+
+	// concurrent review edits both count
+	var wg sync.WaitGroup
+	for token, stars := range map[string]int{first: 1, second: 3} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.do(http.MethodPut, reviews, token, types.ReviewClient{Rating: stars})
+		}()
+	}
+	wg.Wait()
+	if avg, n := rating(); avg != 2 || n != 2 {
+		t.Errorf("rating after concurrent edits = %v over %v, want 2 over 2", avg, n)
+	}
+}
+
+func TestWishlists(t *testing.T) {
+	h := newHarness(t)
+	token := h.signUp("saver@test.local", "saver-password")
+	other := h.signUp("other@test.local", "other-password")
+	products := h.products()
+	kettle, lamp := productID(products[0]), productID(products[1])
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/wishlists", token, types.WishlistClient{Name: "Birthday"})
+	id, _ := resp.Body["data"].(map[string]interface{})["_id"].(string)
+	path := "/wishlists/" + id
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/wishlists", token, types.WishlistClient{Name: "Birthday"})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/wishlists", token, types.WishlistClient{Name: "  "})
+
+	// saving needs no address, and saving twice keeps one entry
+	h.mustDo(http.StatusOK, http.MethodPost, path+"/items", token, types.WishlistItemClient{ProductID: lamp})
+	h.mustDo(http.StatusOK, http.MethodPost, path+"/items", token, types.WishlistItemClient{ProductID: kettle})
+	resp = h.mustDo(http.StatusOK, http.MethodPost, path+"/items", token, types.WishlistItemClient{ProductID: lamp})
+	saved := resp.Body["data"].(map[string]interface{})["products"].([]interface{})
+	if len(saved) != 2 || productID(saved[0]) != lamp || productID(saved[1]) != kettle {
+		t.Errorf("saved products = %v, want the lamp then the kettle", saved)
+	}
+	h.mustDo(http.StatusNotFound, http.MethodPost, path+"/items", token, types.WishlistItemClient{ProductID: primitive.NewObjectID().Hex()})
+
+	// other users can't see or change it
+	h.mustDo(http.StatusForbidden, http.MethodGet, path, other, nil)
+	h.mustDo(http.StatusForbidden, http.MethodPost, path+"/items", other, types.WishlistItemClient{ProductID: lamp})
+	lists := h.mustDo(http.StatusOK, http.MethodGet, "/wishlists", other, nil).Body["data"].([]interface{})
+	if len(lists) != 0 {
+		t.Errorf("other user's wishlists = %v, want none", lists)
+	}
+
+	// moving to the cart needs an address, like adding to it does
+	h.mustDo(http.StatusBadRequest, http.MethodPost, path+"/items/"+kettle+"/move-to-cart", token, nil)
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+	resp = h.mustDo(http.StatusOK, http.MethodPost, path+"/items/"+kettle+"/move-to-cart", token, nil)
+	if saved := resp.Body["data"].(map[string]interface{})["products"].([]interface{}); len(saved) != 1 || productID(saved[0]) != lamp {
+		t.Errorf("products after move = %v, want only the lamp", saved)
+	}
+	user, _ := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), "saver@test.local", constant.UserCollection)
+	carts, _ := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	if len(carts) != 1 || carts[0].ProductID.Hex() != kettle {
+		t.Errorf("carts = %v, want the kettle", carts)
+	}
+	h.mustDo(http.StatusNotFound, http.MethodPost, path+"/items/"+kettle+"/move-to-cart", token, nil)
+
+	// a share link gives a read-only view without logging in, until revoked
+	share := h.mustDo(http.StatusOK, http.MethodPost, path+"/share", token, nil).Body["data"].(map[string]interface{})
+	link := share["path"].(string)
+	again := h.mustDo(http.StatusOK, http.MethodPost, path+"/share", token, nil).Body["data"].(map[string]interface{})
+	if again["path"] != link {
+		t.Errorf("sharing twice gave %v and %v", link, again["path"])
+	}
+	shared := h.mustDoURL(http.StatusOK, http.MethodGet, link).Body["data"].(map[string]interface{})
+	if shared["name"] != "Birthday" || len(shared["products"].([]interface{})) != 1 || shared["_id"] != nil || shared["share_token"] != nil {
+		t.Errorf("shared view = %v", shared)
+	}
+	h.mustDo(http.StatusOK, http.MethodDelete, path+"/share", token, nil)
+	h.mustDoURL(http.StatusNotFound, http.MethodGet, link)
+
+	h.mustDo(http.StatusOK, http.MethodDelete, path+"/items/"+lamp, token, nil)
+	h.mustDo(http.StatusOK, http.MethodDelete, path, token, nil)
+	h.mustDo(http.StatusNotFound, http.MethodGet, path, token, nil)
+}
+
+func TestProductVariants(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	token := h.signUp("shopper@test.local", "shopper-password")
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+
+	shirt := types.ProductClient{
+		Name: "Linen Shirt", Description: "Short sleeves", Price: 30, ImageUrl: "shirt.png",
+		Options: []types.ProductOption{{Name: "size", Values: []string{"S", "M"}}, {Name: "color", Values: []string{"white"}}},
+		Variants: []types.Variant{
+			{SKU: "SHIRT-S-W", Options: map[string]string{"size": "S", "color": "white"}, Stock: 3},
+			{SKU: "SHIRT-M-W", Options: map[string]string{"size": "M", "color": "white"}, Price: 34, Stock: 0, Images: []string{"shirt-m.png"}},
+		},
+	}
+
+	// variants must fit the options and each other
+	bad := shirt
+	bad.Variants = []types.Variant{shirt.Variants[0], {SKU: "SHIRT-X", Options: map[string]string{"size": "S", "color": "white"}, Stock: 1}}
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/products", adminToken, bad)
+	bad.Variants = []types.Variant{{SKU: "SHIRT-L", Options: map[string]string{"size": "L", "color": "white"}, Stock: 1}}
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/products", adminToken, bad)
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/products", adminToken, shirt)
+	id, _ := resp.Body["data"].(map[string]interface{})["_id"].(string)
+	h.mustDo(http.StatusConflict, http.MethodPost, "/products", adminToken, shirt)
+
+	// list and search show the price range across variants
+	for _, path := range []string{"/products?limit=10", "/products?search=linen"} {
+		data := h.mustDo(http.StatusOK, http.MethodGet, path, "", nil).Body["data"].(map[string]interface{})
+		var found map[string]interface{}
+		for _, p := range data["products"].([]interface{}) {
+			if productID(p) == id {
+				found = p.(map[string]interface{})
+			} else if p.(map[string]interface{})["price_range"] != nil {
+				t.Errorf("%s: product without variants has a price range: %v", path, p)
+			}
+		}
+		if r, _ := found["price_range"].(map[string]interface{}); r["min"] != 30.0 || r["max"] != 34.0 {
+			t.Errorf("%s: shirt = %v, want price range 30 to 34", path, found)
+		}
+	}
+
+	// cart lines name a variant with stock; other products take no sku
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/cart", token, types.CartClient{ProductID: id})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/cart", token, types.CartClient{ProductID: id, SKU: "NOPE"})
+	h.mustDo(http.StatusConflict, http.MethodPost, "/cart", token, types.CartClient{ProductID: id, SKU: "SHIRT-M-W"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: id, SKU: "SHIRT-S-W"})
+	h.mustDo(http.StatusBadRequest, http.MethodPost, "/cart", token, types.CartClient{ProductID: productID(h.products()[0]), SKU: "SHIRT-S-W"})
+	h.mustDo(http.StatusNotFound, http.MethodPost, "/cart", token, types.CartClient{ProductID: primitive.NewObjectID().Hex()})
+
+	user, _ := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), "shopper@test.local", constant.UserCollection)
+	carts, _ := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+	if len(carts) != 1 || carts[0].SKU != "SHIRT-S-W" {
+		t.Errorf("carts = %v, want one SHIRT-S-W line", carts)
+	}
+
+	// restocking through an update replaces the variants
+	restocked := []types.Variant{shirt.Variants[0], shirt.Variants[1]}
+	restocked[1].Stock = 5
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+id, adminToken, types.UpdateProduct{Options: shirt.Options, Variants: &restocked})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: id, SKU: "SHIRT-M-W"})
+
+	// an update that leaves variants out keeps them
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+id, adminToken, types.UpdateProduct{Price: 32})
+	product := h.mustDo(http.StatusOK, http.MethodGet, "/products/"+id, "", nil).Body["data"].(map[string]interface{})
+	if r, _ := product["price_range"].(map[string]interface{}); r["min"] != 32.0 || r["max"] != 34.0 || len(product["variants"].([]interface{})) != 2 {
+		t.Errorf("product after price update = %v", product)
+	}
+
+	// an update without variants doesn't write back stock taken since its read
+	ctx := context.Background()
+	stale, _ := database.Mgr.GetProductBySKU(ctx, "SHIRT-S-W", constant.ProductCollection)
+	if err := database.Mgr.AdjustVariantStock(ctx, stale.Id, "SHIRT-S-W", -1, constant.ProductCollection); err != nil {
+		t.Fatal(err)
+	}
+	stale.Name, stale.Options, stale.Variants = "Linen Shirt II", nil, nil
+	if err := database.Mgr.UpdateProduct(ctx, stale, constant.ProductCollection); err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := database.Mgr.GetProductBySKU(ctx, "SHIRT-S-W", constant.ProductCollection)
+	if v, _ := fresh.Variant("SHIRT-S-W"); fresh.Name != "Linen Shirt II" || v.Stock != 2 {
+		t.Errorf("product after a stale update = %q with stock %d, want the new name and stock 2", fresh.Name, v.Stock)
+	}
+}
+
+func TestCheckoutTakesVariantStock(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	mug := types.ProductClient{
+		Name: "Mug", Description: "Stoneware", Price: 12, ImageUrl: "mug.png",
+		Options:  []types.ProductOption{{Name: "color", Values: []string{"blue"}}},
+		Variants: []types.Variant{{SKU: "MUG-B", Options: map[string]string{"color": "blue"}, Stock: 1}},
+	}
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/products", adminToken, mug)
+	id, _ := resp.Body["data"].(map[string]interface{})["_id"].(string)
+
+	// both buyers get the last unit into their cart, only one checks it out
+	var tokens []string
+	for _, email := range []string{"first@test.local", "second@test.local"} {
+		token := h.signUp(email, "buyer-password")
+		h.mustDo(http.StatusOK, http.MethodPost, "/addresses", token, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+		h.mustDo(http.StatusOK, http.MethodPost, "/cart", token, types.CartClient{ProductID: id, SKU: "MUG-B"})
+		tokens = append(tokens, token)
+	}
+	codes := make(chan int, len(tokens))
+	var wg sync.WaitGroup
+	for _, token := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- h.do(http.MethodPost, "/orders", token, nil).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	got := map[int]int{}
+	for code := range codes {
+		got[code]++
+	}
+	if got[http.StatusOK] != 1 || got[http.StatusConflict] != 1 {
+		t.Errorf("checkout statuses = %v, want one 200 and one 409", got)
+	}
+
+	product, _ := database.Mgr.GetProductBySKU(context.Background(), "MUG-B", constant.ProductCollection)
+	if v, _ := product.Variant("MUG-B"); v.Stock != 0 {
+		t.Errorf("stock after checkout = %d, want 0", v.Stock)
+	}
+	checkedOut := 0
+	for _, email := range []string{"first@test.local", "second@test.local"} {
+		user, _ := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), email, constant.UserCollection)
+		carts, _ := database.Mgr.GetCartObjectListForUser(context.Background(), user.Id, constant.CartCollection)
+		for _, cart := range carts {
+			if cart.Checkout {
+				checkedOut++
+			}
+		}
+	}
+	if checkedOut != 1 {
+		t.Errorf("%d cart lines checked out, want 1", checkedOut)
+	}
+
+	// a buyer checking out twice at once takes stock for each line once
+	restocked := []types.Variant{{SKU: "MUG-B", Options: map[string]string{"color": "blue"}, Stock: 2}}
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+id, adminToken, types.UpdateProduct{Options: mug.Options, Variants: &restocked})
+	third := h.signUp("third@test.local", "buyer-password")
+	h.mustDo(http.StatusOK, http.MethodPost, "/addresses", third, types.AddressClient{Address1: "1 Main St", City: "Springfield", Country: "US"})
+	h.mustDo(http.StatusOK, http.MethodPost, "/cart", third, types.CartClient{ProductID: id, SKU: "MUG-B"})
+	for _, token := range []string{third, third} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.do(http.MethodPost, "/orders", token, nil)
+		}()
+	}
+	wg.Wait()
+	product, _ = database.Mgr.GetProductBySKU(context.Background(), "MUG-B", constant.ProductCollection)
+	if v, _ := product.Variant("MUG-B"); v.Stock != 1 {
+		t.Errorf("stock after a doubled checkout = %d, want 1", v.Stock)
+	}
+}
+
+// upload posts data as the multipart file field "image", claiming contentType.
+func (h *harness) upload(want int, path, token, contentType string, data []byte) response {
+	h.t.Helper()
+
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="image"; filename="upload"`},
+		"Content-Type":        {contentType},
+	})
+	if err == nil {
+		_, err = part.Write(data)
+	}
+	if err == nil {
+		err = form.Close()
+	}
+	if err != nil {
+		h.t.Fatalf("build form: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, constant.APIPrefix+path, &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, req)
+
+	resp := response{Code: rec.Code, Header: rec.Header()}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp.Body); err != nil {
+		h.t.Fatalf("upload %s: decode response %q: %v", path, rec.Body.String(), err)
+	}
+	if resp.Code != want {
+		h.t.Fatalf("upload %s: status %d, want %d: %v", path, resp.Code, want, resp.Body)
+	}
+	return resp
+}
+
+// fetch returns the status and body of a GET outside the API, such as a stored file.
+func (h *harness) fetch(path string) (int, []byte) {
+	rec := httptest.NewRecorder()
+	h.engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestProductImages(t *testing.T) {
+	h := newHarness(t)
+	adminToken := h.login(testAdminEmail, testAdminPassword)
+	userToken := h.signUp("viewer@test.local", "viewer-password")
+	id := productID(h.products()[0])
+	path := "/products/" + id + "/images"
+	picture, photo := imagingtest.Encode(t, 600, 300, false), imagingtest.Encode(t, 40, 40, true)
+
+	h.upload(http.StatusForbidden, path, userToken, "image/png", picture)
+	h.upload(http.StatusUnsupportedMediaType, path, adminToken, "image/png", []byte("<svg xmlns='http://www.w3.org/2000/svg'/>"))
+	h.upload(http.StatusRequestEntityTooLarge, path, adminToken, "image/png", make([]byte, config.Default().Storage.MaxUploadBytes+1))
+	h.upload(http.StatusNotFound, "/products/"+primitive.NewObjectID().Hex()+"/images", adminToken, "image/png", picture)
+
+	// the type comes from the content, and a thumbnail is stored alongside
+	first := h.upload(http.StatusOK, path, adminToken, "application/octet-stream", picture).Body["data"].(map[string]interface{})
+	if first["content_type"] != "image/png" || first["width"] != 600.0 || first["height"] != 300.0 || first["key"] != nil {
+		t.Errorf("uploaded image = %v", first)
+	}
+	if code, body := h.fetch(first["url"].(string)); code != http.StatusOK || !bytes.Equal(body, picture) {
+		t.Errorf("GET %v: status %d", first["url"], code)
+	}
+	code, body := h.fetch(first["thumbnail_url"].(string))
+	thumb, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if code != http.StatusOK || err != nil || thumb.Width != 320 || thumb.Height != 160 {
+		t.Errorf("thumbnail: status %d, %+v, %v; want 320x160", code, thumb, err)
+	}
+	second := h.upload(http.StatusOK, path, adminToken, "image/jpeg", photo).Body["data"].(map[string]interface{})
+
+	gallery := func() []interface{} {
+		product := h.mustDo(http.StatusOK, http.MethodGet, "/products/"+id, "", nil).Body["data"].(map[string]interface{})
+		images, _ := product["images"].([]interface{})
+		return images
+	}
+	ids := func(images []interface{}) []interface{} {
+		var out []interface{}
+		for _, image := range images {
+			out = append(out, image.(map[string]interface{})["id"])
+		}
+		return out
+	}
+	if got := ids(gallery()); !slices.Equal(got, []interface{}{first["id"], second["id"]}) {
+		t.Errorf("gallery = %v, want the upload order", got)
+	}
+
+	// reordering must name every image once
+	h.mustDo(http.StatusBadRequest, http.MethodPut, path, adminToken, types.ProductImageOrder{ImageIDs: []string{second["id"].(string)}})
+	h.mustDo(http.StatusBadRequest, http.MethodPut, path, adminToken, types.ProductImageOrder{ImageIDs: []string{second["id"].(string), second["id"].(string)}})
+	h.mustDo(http.StatusOK, http.MethodPut, path, adminToken, types.ProductImageOrder{ImageIDs: []string{second["id"].(string), first["id"].(string)}})
+
+	// editing the product leaves the gallery alone
+	h.mustDo(http.StatusOK, http.MethodPut, "/products/"+id, adminToken, types.UpdateProduct{Price: 27})
+	if got := ids(gallery()); !slices.Equal(got, []interface{}{second["id"], first["id"]}) {
+		t.Errorf("gallery after reorder and update = %v", got)
+	}
+	oid, _ := primitive.ObjectIDFromHex(id)
+	stale, _ := database.Mgr.GetSingleProductById(context.Background(), oid, constant.ProductCollection)
+	stale.Images, stale.RatingAverage, stale.RatingCount = stale.Images[:1], 5, 1
+	if err := database.Mgr.UpdateProduct(context.Background(), stale, constant.ProductCollection); err != nil {
+		t.Fatalf("UpdateProduct() error = %v", err)
+	}
+	product, _ := database.Mgr.GetSingleProductById(context.Background(), oid, constant.ProductCollection)
+	if len(product.Images) != 2 || product.RatingCount != 0 {
+		t.Errorf("UpdateProduct wrote the gallery or rating: %d images, %d ratings", len(product.Images), product.RatingCount)
+	}
+
+	// writes made from a stale read of the gallery are refused
+	if err := database.Mgr.AddProductImage(context.Background(), oid, types.ProductImage{ID: "late"}, 2, 0, constant.ProductCollection); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("AddProductImage() to a full gallery error = %v, want ErrNoDocuments", err)
+	}
+	if err := database.Mgr.SetProductImages(context.Background(), oid, stale.Images, 0, constant.ProductCollection); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("SetProductImages() with a stale gallery error = %v, want ErrNoDocuments", err)
+	}
+
+	// deleting an image or the product removes the stored files
+	h.mustDo(http.StatusOK, http.MethodDelete, path+"/"+first["id"].(string), adminToken, nil)
+	h.mustDo(http.StatusNotFound, http.MethodDelete, path+"/"+first["id"].(string), adminToken, nil)
+	for _, url := range []string{first["url"].(string), first["thumbnail_url"].(string)} {
+		if code, _ := h.fetch(url); code != http.StatusNotFound {
+			t.Errorf("GET %s after delete: status %d", url, code)
+		}
+	}
+	h.mustDo(http.StatusOK, http.MethodDelete, "/products/"+id, adminToken, nil)
+	if code, _ := h.fetch(second["url"].(string)); code != http.StatusNotFound {
+		t.Errorf("GET %s after deleting the product: status %d", second["url"], code)
+	}
+}
+
+func TestLegacyRoutesAreDeprecatedAliases(t *testing.T) {
+	h := newHarness(t)
+
+	resp := h.mustDo(http.StatusOK, http.MethodPost, "/auth/login", "", types.Login{Email: testAdminEmail, Password: testAdminPassword})
+	if resp.Header.Get("Deprecation") != "" {
+		t.Errorf("v1 route sent Deprecation: %s", resp.Header.Get("Deprecation"))
+	}
+
+	// the harness serves the legacy routes under /api/v1, as API_VERSION=/api/v1 did
+	resp = h.mustDo(http.StatusOK, http.MethodPost, "/ecommerce/login", "", types.Login{Email: testAdminEmail, Password: testAdminPassword})
+	if resp.Header.Get("Deprecation") == "" {
+		t.Error("legacy route sent no Deprecation header")
+	}
+	if link := resp.Header.Get("Link"); link != `</api/v1/auth/login>; rel="successor-version"` {
+		t.Errorf("Link = %q", link)
+	}
+	token, _ := resp.Body["token"].(string)
+
+	admin, err := database.Mgr.GetSingleRecordByEmailForUser(context.Background(), testAdminEmail, constant.UserCollection)
+	if err != nil {
+		t.Fatalf("get admin: %v", err)
+	}
+	resp = h.mustDo(http.StatusOK, http.MethodPost, "/ecommerce/user/"+admin.Id.Hex(), token, nil)
+	if link := resp.Header.Get("Link"); link != `</api/v1/users/`+admin.Id.Hex()+`>; rel="successor-version"` {
+		t.Errorf("Link = %q", link)
+	}
+
+	resp = h.mustDo(http.StatusOK, http.MethodGet, "/ecommerce-product/list-products", "", nil)
+	if resp.Header.Get("Deprecation") == "" {
+		t.Error("legacy product route sent no Deprecation header")
+	}
+}
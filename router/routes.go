@@ -1,37 +1,146 @@
 package router
 
 import (
+	"ecommerce-project/config"
 	"ecommerce-project/constant"
 	"ecommerce-project/controller"
+	"ecommerce-project/types"
 	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limits for the routes that send email or check credentials, one budget each;
+// a legacy route uses the limit of the v1 route replacing it
+var (
+	verificationEmailRateLimit  = RateLimit{Key: "verification-email", Requests: 5, Per: time.Minute}
+	verifyOtpRateLimit          = RateLimit{Key: "verify-otp", Requests: 10, Per: time.Minute}
+	loginRateLimit              = RateLimit{Key: "login", Requests: 10, Per: time.Minute}
+	emailChangeRateLimit        = RateLimit{Key: "email-change", Requests: 5, Per: time.Minute}
+	emailChangeConfirmRateLimit = RateLimit{Key: "email-change-confirm", Requests: 10, Per: time.Minute}
 )
 
+var adminOnly = []string{constant.AdminUser}
+
+var healthRoutes = Routes{
+	{Name: "Health", Method: http.MethodGet, Pattern: constant.HealthCheckRoute, HandlerFunc: controller.HealthCheck, Response: types.HealthResponse{}},
+	{Name: "Readiness", Method: http.MethodGet, Pattern: constant.ReadinessRoute, HandlerFunc: controller.ReadinessCheck, Response: types.ReadinessResponse{}},
+}
+
+// v1 routes, mounted under constant.APIPrefix
+
+var apiRoutes = Routes{
+	{Name: "Verify Email", Method: http.MethodPost, Pattern: constant.AuthVerifyEmailRoute, HandlerFunc: controller.VerifyEmail, RateLimit: verificationEmailRateLimit, Request: types.Verification{}, Response: types.Response{}},
+	{Name: "Verify Otp", Method: http.MethodPost, Pattern: constant.AuthVerifyOtpRoute, HandlerFunc: controller.VerifyOtp, RateLimit: verifyOtpRateLimit, Request: types.Verification{}, Response: types.Response{}},
+	{Name: "Resend Email", Method: http.MethodPost, Pattern: constant.AuthResendEmailRoute, HandlerFunc: controller.VerifyEmail, RateLimit: verificationEmailRateLimit, Request: types.Verification{}, Response: types.Response{}},
+	{Name: "Login", Method: http.MethodPost, Pattern: constant.AuthLoginRoute, HandlerFunc: controller.UserLogin, RateLimit: loginRateLimit, Request: types.Login{}, Response: types.TokenResponse{}},
+
+	{Name: "Register User", Method: http.MethodPost, Pattern: constant.UsersRoute, HandlerFunc: controller.RegisterUser, Request: types.UserClient{}, Response: types.RegisterResponse{}},
+	{Name: "Get User", Method: http.MethodGet, Pattern: constant.UserRoute, HandlerFunc: controller.GetSingleUser, Auth: true, Response: types.UserResponse{}},
+	{Name: "Update User", Method: http.MethodPut, Pattern: constant.UserRoute, HandlerFunc: controller.UpdateUser, Auth: true, AllowPasswordChange: true, Request: types.UserUpdateClient{}, Response: types.UserResponse{}},
+	{Name: "Request Email Change", Method: http.MethodPost, Pattern: constant.UserEmailRoute, HandlerFunc: controller.RequestEmailChange, Auth: true, RateLimit: emailChangeRateLimit, Request: types.EmailChangeClient{}, Response: types.Response{}},
+	{Name: "Confirm Email Change", Method: http.MethodPost, Pattern: constant.UserEmailVerifyRoute, HandlerFunc: controller.ConfirmEmailChange, Auth: true, RateLimit: emailChangeConfirmRateLimit, Request: types.EmailChangeConfirmClient{}, Response: types.EmailChangeResponse{}},
+
+	{Name: "List Products", Method: http.MethodGet, Pattern: constant.ProductsRoute, HandlerFunc: controller.ListProductsController, Request: types.ProductSearchQuery{}, Response: types.ProductListResponse{}},
+	{Name: "Get Product", Method: http.MethodGet, Pattern: constant.ProductRoute, HandlerFunc: controller.GetProduct, Response: types.ProductResponse{}},
+	{Name: "Create Product", Method: http.MethodPost, Pattern: constant.ProductsRoute, HandlerFunc: controller.RegisterProduct, Roles: adminOnly, Request: types.ProductClient{}, Response: types.ProductResponse{}},
+	{Name: "Update Product", Method: http.MethodPut, Pattern: constant.ProductRoute, HandlerFunc: controller.UpdateProduct, Roles: adminOnly, Request: types.UpdateProduct{}, Response: types.UpdateProductResponse{}},
+	{Name: "Delete Product", Method: http.MethodDelete, Pattern: constant.ProductRoute, HandlerFunc: controller.DeleteProduct, Roles: adminOnly, Response: types.Response{}},
+	{Name: "Upload Product Image", Method: http.MethodPost, Pattern: constant.ProductImagesRoute, HandlerFunc: controller.UploadProductImage, Roles: adminOnly, Request: types.ProductImageUpload{}, Response: types.ProductImageResponse{}},
+	{Name: "Reorder Product Images", Method: http.MethodPut, Pattern: constant.ProductImagesRoute, HandlerFunc: controller.ReorderProductImages, Roles: adminOnly, Request: types.ProductImageOrder{}, Response: types.ProductImageListResponse{}},
+	{Name: "Delete Product Image", Method: http.MethodDelete, Pattern: constant.ProductImageRoute, HandlerFunc: controller.DeleteProductImage, Roles: adminOnly, Response: types.Response{}},
+	{Name: "List Reviews", Method: http.MethodGet, Pattern: constant.ProductReviewsRoute, HandlerFunc: controller.ListReviews, Request: types.ReviewListQuery{}, Response: types.ReviewListResponse{}},
+	{Name: "Review Product", Method: http.MethodPut, Pattern: constant.ProductReviewsRoute, HandlerFunc: controller.PutReview, Auth: true, Request: types.ReviewClient{}, Response: types.ReviewResponse{}},
+	{Name: "Moderate Review", Method: http.MethodPut, Pattern: constant.ReviewModerateRoute, HandlerFunc: controller.ModerateReview, Roles: adminOnly, Request: types.ReviewModeration{}, Response: types.ReviewResponse{}},
+
+	{Name: "Add To Cart", Method: http.MethodPost, Pattern: constant.CartRoute, HandlerFunc: controller.AddToCart, Auth: true, Request: types.CartClient{}, Response: types.Response{}},
+	{Name: "Add Address", Method: http.MethodPost, Pattern: constant.AddressesRoute, HandlerFunc: controller.AddAddressOfUser, Auth: true, Request: types.AddressClient{}, Response: types.Response{}},
+	{Name: "Create Order", Method: http.MethodPost, Pattern: constant.OrdersRoute, HandlerFunc: controller.CheckoutOrder, Auth: true, Response: types.Response{}},
+	{Name: "List Wishlists", Method: http.MethodGet, Pattern: constant.WishlistsRoute, HandlerFunc: controller.ListWishlists, Auth: true, Response: types.WishlistListResponse{}},
+	{Name: "Create Wishlist", Method: http.MethodPost, Pattern: constant.WishlistsRoute, HandlerFunc: controller.CreateWishlist, Auth: true, Request: types.WishlistClient{}, Response: types.WishlistResponse{}},
+	{Name: "Get Wishlist", Method: http.MethodGet, Pattern: constant.WishlistRoute, HandlerFunc: controller.GetWishlist, Auth: true, Response: types.WishlistResponse{}},
+	{Name: "Delete Wishlist", Method: http.MethodDelete, Pattern: constant.WishlistRoute, HandlerFunc: controller.DeleteWishlist, Auth: true, Response: types.Response{}},
+	{Name: "Add Wishlist Item", Method: http.MethodPost, Pattern: constant.WishlistItemsRoute, HandlerFunc: controller.AddWishlistItem, Auth: true, Request: types.WishlistItemClient{}, Response: types.WishlistResponse{}},
+	{Name: "Remove Wishlist Item", Method: http.MethodDelete, Pattern: constant.WishlistItemRoute, HandlerFunc: controller.RemoveWishlistItem, Auth: true, Response: types.WishlistResponse{}},
+	{Name: "Move Wishlist Item To Cart", Method: http.MethodPost, Pattern: constant.WishlistMoveRoute, HandlerFunc: controller.MoveWishlistItemToCart, Auth: true, Request: types.MoveToCartClient{}, Response: types.WishlistResponse{}},
+	{Name: "Share Wishlist", Method: http.MethodPost, Pattern: constant.WishlistShareRoute, HandlerFunc: controller.ShareWishlist, Auth: true, Response: types.WishlistShareResponse{}},
+	{Name: "Unshare Wishlist", Method: http.MethodDelete, Pattern: constant.WishlistShareRoute, HandlerFunc: controller.UnshareWishlist, Auth: true, Response: types.Response{}},
+	{Name: "Get Shared Wishlist", Method: http.MethodGet, Pattern: constant.SharedWishlistRoute, HandlerFunc: controller.GetSharedWishlist, Response: types.SharedWishlistResponse{}},
+
+	{Name: "Mark Order Delivered", Method: http.MethodPost, Pattern: constant.OrderDeliveredRoute, HandlerFunc: controller.MarkOrderDelivered, Roles: adminOnly, Response: types.Response{}},
+}
+
+// Legacy routes, mounted under the configured legacy prefix. They are deprecated
+// aliases of the v1 routes above; see legacySuccessors.
+
 var userRoutes = Routes{
-	Route{"VerifyEmail", http.MethodPost, constant.VerifyEmailRoute, controller.VerifyEmail},
-	Route{"VerifyOtp", http.MethodPost, constant.VerifyOtpRoute, controller.VerifyOtp},
-	Route{"Email", http.MethodPost, constant.ResendEmailRoute, controller.VerifyEmail},
+	{Name: "VerifyEmail", Method: http.MethodPost, Pattern: constant.VerifyEmailRoute, HandlerFunc: controller.VerifyEmail, RateLimit: verificationEmailRateLimit, Request: types.Verification{}, Response: types.Response{}},
+	{Name: "VerifyOtp", Method: http.MethodPost, Pattern: constant.VerifyOtpRoute, HandlerFunc: controller.VerifyOtp, RateLimit: verifyOtpRateLimit, Request: types.Verification{}, Response: types.Response{}},
+	{Name: "Email", Method: http.MethodPost, Pattern: constant.ResendEmailRoute, HandlerFunc: controller.VerifyEmail, RateLimit: verificationEmailRateLimit, Request: types.Verification{}, Response: types.Response{}},
 
 	// Resister User
-	Route{"RegisterUser", http.MethodPost, constant.UserRegisterRoute, controller.RegisterUser},
-	Route{"LoginUser", http.MethodPost, constant.UserLoginRoute, controller.UserLogin},
+	{Name: "RegisterUser", Method: http.MethodPost, Pattern: constant.UserRegisterRoute, HandlerFunc: controller.RegisterUser, Request: types.UserClient{}, Response: types.RegisterResponse{}},
+	{Name: "LoginUser", Method: http.MethodPost, Pattern: constant.UserLoginRoute, HandlerFunc: controller.UserLogin, RateLimit: loginRateLimit, Request: types.Login{}, Response: types.TokenResponse{}},
 }
 
 var productGlobalRoutes = Routes{
-	Route{"List Product", http.MethodGet, constant.ListProductRoute, controller.ListProductsController},
-	Route{"Search Product", http.MethodPost, constant.SearchProductRoute, controller.SearchProduct},
+	{Name: "List Product", Method: http.MethodGet, Pattern: constant.ListProductRoute, HandlerFunc: controller.ListProductsController, Request: types.ProductListQuery{}, Response: types.ProductListResponse{}},
+	{Name: "Search Product", Method: http.MethodPost, Pattern: constant.SearchProductRoute, HandlerFunc: controller.SearchProduct, Request: types.ProductSearchQuery{}, Response: types.ProductListResponse{}},
 }
 
 var productRoutes = Routes{
-	Route{"Register Product", http.MethodPost, constant.RegisterProductRoute, controller.RegisterProduct},
-	Route{"Update Product", http.MethodPut, constant.UpdateProductRoute, controller.UpdateProduct },
-	Route{"Delete PRoduct", http.MethodDelete, constant.DeleteProductRoute, controller.DeleteProduct},
+	{Name: "Register Product", Method: http.MethodPost, Pattern: constant.RegisterProductRoute, HandlerFunc: controller.RegisterProduct, Roles: adminOnly, Request: types.ProductClient{}, Response: types.ProductResponse{}},
+	{Name: "Update Product", Method: http.MethodPut, Pattern: constant.UpdateProductRoute, HandlerFunc: controller.UpdateProduct, Roles: adminOnly, Request: types.UpdateProduct{}, Response: types.UpdateProductResponse{}},
+	{Name: "Delete PRoduct", Method: http.MethodDelete, Pattern: constant.DeleteProductRoute, HandlerFunc: controller.DeleteProduct, Roles: adminOnly, Request: types.ProductIdQuery{}, Response: types.Response{}},
 }
 
-
 var userAuthRoutes = Routes{
-	Route{"Add to cart", http.MethodPost, constant.AddToCartRoute, controller.AddToCart},
-	Route{"AddAddress", http.MethodPost, constant.AddAddressRoute, controller.AddAddressOfUser},
-	Route{"Get Single User", http.MethodPost, constant.GetSingleUserRoute, controller.GetSingleUser},
-	Route{"Update User", http.MethodPut, constant.UpdateUser, controller.UpdateUser},
-	Route{"Checkout Order", http.MethodPut, constant.CheckoutRoute, controller.CheckoutOrder},
-}
\ No newline at end of file
+	{Name: "Add to cart", Method: http.MethodPost, Pattern: constant.AddToCartRoute, HandlerFunc: controller.AddToCart, Auth: true, Request: types.CartClient{}, Response: types.Response{}},
+	{Name: "AddAddress", Method: http.MethodPost, Pattern: constant.AddAddressRoute, HandlerFunc: controller.AddAddressOfUser, Auth: true, Request: types.AddressClient{}, Response: types.Response{}},
+	{Name: "Get Single User", Method: http.MethodPost, Pattern: constant.GetSingleUserRoute, HandlerFunc: controller.GetSingleUser, Auth: true, Response: types.UserResponse{}},
+	{Name: "Update User", Method: http.MethodPut, Pattern: constant.UpdateUser, HandlerFunc: controller.UpdateUser, Auth: true, AllowPasswordChange: true, Request: types.UserUpdateClient{}, Response: types.UserResponse{}},
+	{Name: "Checkout Order", Method: http.MethodPut, Pattern: constant.CheckoutRoute, HandlerFunc: controller.CheckoutOrder, Auth: true, Response: types.Response{}},
+}
+
+// routeGroups lists every route group NewRouter registers; the OpenAPI document
+// is generated from the same list, so the two can't drift apart.
+func routeGroups(cfg *config.Config) []RouteGroup {
+	legacy := cfg.Server.LegacyPrefix
+	legacyMiddleware := []gin.HandlerFunc{deprecated(legacy)}
+
+	return []RouteGroup{
+		{Prefix: "", Routes: healthRoutes},
+		{Prefix: constant.APIPrefix, Routes: apiRoutes},
+		{Prefix: legacy + constant.LegacyGroup, Routes: concat(userRoutes, productRoutes, userAuthRoutes), Middleware: legacyMiddleware, Deprecated: true},
+		{Prefix: legacy + constant.LegacyProductGroup, Routes: productGlobalRoutes, Middleware: legacyMiddleware, Deprecated: true},
+	}
+}
+
+func concat(tables ...Routes) Routes {
+	var all Routes
+	for _, t := range tables {
+		all = append(all, t...)
+	}
+	return all
+}
+
+// legacySuccessors maps "METHOD path" of each legacy route, relative to the legacy
+// prefix, to the v1 route replacing it. It feeds the Link header on deprecated responses.
+var legacySuccessors = map[string]string{
+	"POST " + constant.LegacyGroup + constant.VerifyEmailRoute:          constant.APIPrefix + constant.AuthVerifyEmailRoute,
+	"POST " + constant.LegacyGroup + constant.VerifyOtpRoute:            constant.APIPrefix + constant.AuthVerifyOtpRoute,
+	"POST " + constant.LegacyGroup + constant.ResendEmailRoute:          constant.APIPrefix + constant.AuthResendEmailRoute,
+	"POST " + constant.LegacyGroup + constant.UserRegisterRoute:         constant.APIPrefix + constant.UsersRoute,
+	"POST " + constant.LegacyGroup + constant.UserLoginRoute:            constant.APIPrefix + constant.AuthLoginRoute,
+	"GET " + constant.LegacyProductGroup + constant.ListProductRoute:    constant.APIPrefix + constant.ProductsRoute,
+	"POST " + constant.LegacyProductGroup + constant.SearchProductRoute: constant.APIPrefix + constant.ProductsRoute,
+	"POST " + constant.LegacyGroup + constant.RegisterProductRoute:      constant.APIPrefix + constant.ProductsRoute,
+	"PUT " + constant.LegacyGroup + constant.UpdateProductRoute:         constant.APIPrefix + constant.ProductRoute,
+	"DELETE " + constant.LegacyGroup + constant.DeleteProductRoute:      constant.APIPrefix + constant.ProductRoute,
+	"POST " + constant.LegacyGroup + constant.AddToCartRoute:            constant.APIPrefix + constant.CartRoute,
+	"POST " + constant.LegacyGroup + constant.AddAddressRoute:           constant.APIPrefix + constant.AddressesRoute,
+	"POST " + constant.LegacyGroup + constant.GetSingleUserRoute:        constant.APIPrefix + constant.UserRoute,
+	"PUT " + constant.LegacyGroup + constant.UpdateUser:                 constant.APIPrefix + constant.UserRoute,
+	"PUT " + constant.LegacyGroup + constant.CheckoutRoute:              constant.APIPrefix + constant.OrdersRoute,
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"ecommerce-project/config"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps files in a directory. The router serves the directory under
+// the configured URL prefix.
+type Local struct {
+	dir       string
+	urlPrefix string
+}
+
+// NewLocal returns a backend writing under cfg.Dir, which is created on the
+// first Put if needed.
+func NewLocal(cfg config.Local) *Local {
+	return &Local{dir: cfg.Dir, urlPrefix: cfg.URLPrefix}
+}
+
+// path maps key into the directory, refusing keys that would escape it.
+func (l *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes body to a temporary file and renames it into place, so readers
+// never see a partly written file.
+func (l *Local) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.urlPrefix + "/" + key
+}
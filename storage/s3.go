@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecommerce-project/config"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 keeps files in a bucket of AWS S3 or a compatible service such as MinIO.
+// It speaks the REST API directly, signing requests with AWS Signature Version 4.
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	publicURL string
+	client    *http.Client
+}
+
+// NewS3 returns a backend for the bucket described by cfg.
+func NewS3(cfg config.S3) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("S3_ENDPOINT: %w", err)
+	}
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		region:    cfg.Region,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+		pathStyle: cfg.PathStyle,
+		publicURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// object returns the URL of key in the bucket and its escaped path.
+func (s *S3) object(key string) (*url.URL, string) {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		path += "/" + escapeKey(s.bucket)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	path += "/" + escapeKey(key)
+	u.Path, _ = url.PathUnescape(path)
+	u.RawPath = path
+	return &u, path
+}
+
+func (s *S3) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	u, path := s.object(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return s.do(req, path, body, http.StatusOK)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	u, path := s.object(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	// S3 answers 204 whether or not the object existed
+	return s.do(req, path, nil, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+func (s *S3) URL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + escapeKey(key)
+	}
+	u, _ := s.object(key)
+	return u.String()
+}
+
+// do signs and sends req, failing unless the response status is one of ok.
+func (s *S3) do(req *http.Request, path string, payload []byte, ok ...int) error {
+	sum := sha256.Sum256(payload)
+	signV4(req, path, hex.EncodeToString(sum[:]), s.region, s.accessKey, s.secretKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	// S3 explains failures in a short XML document
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", req.Method, path, resp.Status, bytes.TrimSpace(detail))
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req. path is the escaped
+// request path and payloadHash the hex SHA-256 of the body. The host and every
+// header already set on req are signed.
+func signV4(req *http.Request, path, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeKey percent-encodes key the way Signature Version 4 expects: every byte
+// except unreserved characters and the slashes between segments.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
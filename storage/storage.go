@@ -0,0 +1,36 @@
+// Package storage keeps uploaded files, such as product images, either in a
+// local directory the API serves itself or in an S3-compatible bucket.
+//
+// Files are addressed by slash-separated keys like products/<id>/<name>.jpg;
+// URL turns a key into the address clients fetch the file from.
+package storage
+
+import (
+	"context"
+	"ecommerce-project/config"
+	"fmt"
+)
+
+// Backend stores and removes files.
+type Backend interface {
+	// Put stores body under key, replacing any file already there.
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	// Delete removes the file under key. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns where clients can fetch the file under key.
+	URL(key string) string
+}
+
+// Files is the Backend used by the handlers. main installs the configured one.
+var Files Backend
+
+// New returns the backend selected by cfg.Driver.
+func New(cfg config.Storage) (Backend, error) {
+	switch cfg.Driver {
+	case config.LocalStorage:
+		return NewLocal(cfg.Local), nil
+	case config.S3Storage:
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+}
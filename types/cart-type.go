@@ -6,10 +6,21 @@ type Cart struct {
 	Id        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
 	UserId    primitive.ObjectID `json:"user_id" bson:"user_id"`
 	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
-	Checkout  bool               `json:"checkout,omitempty" bson:"checkout"`
+	// SKU names the variant bought, for products that have variants.
+	SKU      string `json:"sku,omitempty" bson:"sku,omitempty"`
+	Checkout bool   `json:"checkout,omitempty" bson:"checkout"`
+	// DeliveredAt is set once a checked-out line has been delivered.
+	DeliveredAt int64 `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
 }
 
 type CartClient struct {
 	UserId    string `json:"user_id" bson:"user_id"`
 	ProductID string `json:"product_id" bson:"product_id"`
+	// SKU is required for products with variants.
+	SKU string `json:"sku,omitempty" bson:"sku,omitempty"`
+}
+
+// MoveToCartClient picks the variant to put in the cart, for products that have variants.
+type MoveToCartClient struct {
+	SKU string `json:"sku,omitempty"`
 }
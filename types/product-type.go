@@ -1,6 +1,10 @@
 package types
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"mime/multipart"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type Product struct {
 	Id          primitive.ObjectID     `json:"_id" bson:"_id,omitempty"`
@@ -9,8 +13,104 @@ type Product struct {
 	Price       float64                `json:"price" bson:"price"`
 	ImageUrl    string                 `json:"image_url" bson:"image_url"`
 	MetaInfo    map[string]interface{} `json:"meta_info" bson:"meta_info"`
-	CreatedAt   int64                  `json:"created_at" bson:"created_at"`
-	UpdatedAt   int64                  `json:"updated_at" bson:"updated_at"`
+	// Options are the axes the product's variants differ along; every variant
+	// picks one value of each.
+	Options  []ProductOption `json:"options,omitempty" bson:"options"`
+	Variants []Variant       `json:"variants,omitempty" bson:"variants"`
+	// PriceRange spans the prices of the variants. It is computed when the
+	// product is served, never stored.
+	PriceRange *PriceRange `json:"price_range,omitempty" bson:"-"`
+	// Images is the product's gallery, in display order. It is changed only
+	// through the image endpoints; omitempty leaves it out of new products so
+	// the first upload can $push to it.
+	Images []ProductImage `json:"images,omitempty" bson:"images,omitempty"`
+	// RatingAverage and RatingCount summarise the visible reviews. They are only
+	// written when reviews change.
+	RatingAverage float64 `json:"rating_average" bson:"rating_average,omitempty"`
+	RatingCount   int64   `json:"rating_count" bson:"rating_count,omitempty"`
+	CreatedAt     int64   `json:"created_at" bson:"created_at"`
+	UpdatedAt     int64   `json:"updated_at" bson:"updated_at"`
+}
+
+// ProductOption is an axis a product comes in, such as size, with its values.
+type ProductOption struct {
+	Name   string   `json:"name" bson:"name"`
+	Values []string `json:"values" bson:"values"`
+}
+
+// Variant is one purchasable combination of a product's options.
+type Variant struct {
+	SKU string `json:"sku" bson:"sku"`
+	// Options maps each option name of the product to this variant's value.
+	Options map[string]string `json:"options" bson:"options"`
+	// Price overrides the product's price when set.
+	Price  float64  `json:"price,omitempty" bson:"price,omitempty"`
+	Stock  int64    `json:"stock" bson:"stock"`
+	Images []string `json:"images,omitempty" bson:"images,omitempty"`
+}
+
+// ProductImage is one uploaded picture in a product's gallery.
+type ProductImage struct {
+	ID           string `json:"id" bson:"id"`
+	URL          string `json:"url" bson:"url"`
+	ThumbnailURL string `json:"thumbnail_url" bson:"thumbnail_url"`
+	ContentType  string `json:"content_type" bson:"content_type"`
+	Width        int    `json:"width" bson:"width"`
+	Height       int    `json:"height" bson:"height"`
+	Size         int64  `json:"size" bson:"size"`
+	// Key and ThumbnailKey locate the files in storage.
+	Key          string `json:"-" bson:"key"`
+	ThumbnailKey string `json:"-" bson:"thumbnail_key"`
+	CreatedAt    int64  `json:"created_at" bson:"created_at"`
+}
+
+// ProductImageUpload is the multipart form of an image upload.
+type ProductImageUpload struct {
+	Image *multipart.FileHeader `form:"image"`
+}
+
+// ProductImageOrder lists every image ID of a product in the new display order.
+type ProductImageOrder struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// PriceRange is the lowest and highest price a product's variants sell for.
+type PriceRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// VariantPrice returns what the variant sells for.
+func (p Product) VariantPrice(v Variant) float64 {
+	if v.Price > 0 {
+		return v.Price
+	}
+	return p.Price
+}
+
+// Variant returns the variant with the given SKU.
+func (p Product) Variant(sku string) (Variant, bool) {
+	for _, v := range p.Variants {
+		if v.SKU == sku {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// WithPriceRange returns p with PriceRange filled in from its variants.
+// Products without variants are returned unchanged.
+func (p Product) WithPriceRange() Product {
+	if len(p.Variants) == 0 {
+		return p
+	}
+	r := PriceRange{Min: p.VariantPrice(p.Variants[0]), Max: p.VariantPrice(p.Variants[0])}
+	for _, v := range p.Variants[1:] {
+		r.Min = min(r.Min, p.VariantPrice(v))
+		r.Max = max(r.Max, p.VariantPrice(v))
+	}
+	p.PriceRange = &r
+	return p
 }
 
 type ProductClient struct {
@@ -19,6 +119,8 @@ type ProductClient struct {
 	Price       float64                `json:"price" bson:"price"`
 	ImageUrl    string                 `json:"image_url" bson:"image_url"`
 	MetaInfo    map[string]interface{} `json:"meta_info" bson:"meta_info"`
+	Options     []ProductOption        `json:"options,omitempty" bson:"options"`
+	Variants    []Variant              `json:"variants,omitempty" bson:"variants"`
 }
 
 type UpdateProduct struct {
@@ -26,4 +128,28 @@ type UpdateProduct struct {
 	Name        string  `json:"name,omitempty"`
 	Description string  `json:"description,omitempty"`
 	Price       float64 `json:"price,omitempty"`
+	// Options and Variants, when Variants is present, replace the product's
+	// options and variants together. An empty list removes them.
+	Options  []ProductOption `json:"options,omitempty"`
+	Variants *[]Variant      `json:"variants,omitempty"`
+}
+
+// ProductListQuery is the query string accepted when listing products.
+type ProductListQuery struct {
+	Page   int `form:"page"`
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+	// Sort is empty for insertion order or "rating" for the best rated first.
+	Sort string `form:"sort"`
+}
+
+// ProductSearchQuery is the query string accepted when searching products.
+type ProductSearchQuery struct {
+	ProductListQuery
+	Search string `form:"search"`
+}
+
+// ProductIdQuery identifies the product to delete.
+type ProductIdQuery struct {
+	ID string `form:"id"`
 }
@@ -0,0 +1,123 @@
+package types
+
+// Response is the envelope every API response shares. Error is true when the
+// request failed, in which case Message says why.
+type Response struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+}
+
+type TokenResponse struct {
+	Response
+	Token string `json:"token"`
+	// PasswordChangeRequired means the token only allows changing the password;
+	// log in again afterwards for a full one.
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+type RegisterResponse struct {
+	Response
+	Data  UserProfile `json:"data"`
+	Token string      `json:"token"`
+}
+
+// UserResponse carries the view of the user the caller may see.
+type UserResponse struct {
+	Response
+	Data UserView `json:"data"`
+}
+
+// UserView documents the data of a UserResponse, which depends on the caller:
+// administrators get an AdminUserView and users their own UserProfile.
+type UserView struct{}
+
+// OneOf lists the shapes a UserView takes, for the OpenAPI document.
+func (UserView) OneOf() []interface{} {
+	return []interface{}{UserProfile{}, AdminUserView{}}
+}
+
+// EmailChangeResponse returns the updated profile and a token issued for the new address.
+type EmailChangeResponse struct {
+	Response
+	Data  UserProfile `json:"data"`
+	Token string      `json:"token"`
+}
+
+type ProductResponse struct {
+	Response
+	Data Product `json:"data"`
+}
+
+type UpdateProductResponse struct {
+	Response
+	Data UpdateProduct `json:"data"`
+}
+
+type ProductList struct {
+	Products   []Product `json:"products"`
+	TotalCount int64     `json:"totalcount"`
+}
+
+type ProductListResponse struct {
+	Response
+	Data ProductList `json:"data"`
+}
+
+type ReviewResponse struct {
+	Response
+	Data Review `json:"data"`
+}
+
+type ReviewList struct {
+	Reviews    []Review `json:"reviews"`
+	TotalCount int64    `json:"totalcount"`
+}
+
+type ReviewListResponse struct {
+	Response
+	Data ReviewList `json:"data"`
+}
+
+type WishlistResponse struct {
+	Response
+	Data WishlistDetail `json:"data"`
+}
+
+type WishlistListResponse struct {
+	Response
+	Data []Wishlist `json:"data"`
+}
+
+type SharedWishlistResponse struct {
+	Response
+	Data SharedWishlist `json:"data"`
+}
+
+type WishlistShareResponse struct {
+	Response
+	Data WishlistShare `json:"data"`
+}
+
+type ProductImageResponse struct {
+	Response
+	Data ProductImage `json:"data"`
+}
+
+type ProductImageListResponse struct {
+	Response
+	Data []ProductImage `json:"data"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
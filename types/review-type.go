@@ -0,0 +1,36 @@
+package types
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Review is a user's rating and review of a product. Each user has at most one
+// per product; posting again edits it.
+type Review struct {
+	Id        primitive.ObjectID `json:"_id" bson:"_id,omitempty"`
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	UserId    primitive.ObjectID `json:"-" bson:"user_id"`
+	UserName  string             `json:"user_name" bson:"user_name"`
+	Rating    int                `json:"rating" bson:"rating"`
+	Text      string             `json:"text" bson:"text"`
+	// Hidden reviews are left out of listings and product ratings.
+	Hidden       bool   `json:"hidden,omitempty" bson:"hidden"`
+	HiddenReason string `json:"hidden_reason,omitempty" bson:"hidden_reason,omitempty"`
+	CreatedAt    int64  `json:"created_at" bson:"created_at"`
+	UpdatedAt    int64  `json:"updated_at" bson:"updated_at"`
+}
+
+type ReviewClient struct {
+	Rating int    `json:"rating"`
+	Text   string `json:"text"`
+}
+
+// ReviewModeration hides or restores a review.
+type ReviewModeration struct {
+	Hidden bool   `json:"hidden"`
+	Reason string `json:"reason"`
+}
+
+// ReviewListQuery is the query string accepted when listing a product's reviews.
+type ReviewListQuery struct {
+	Page  int `form:"page"`
+	Limit int `form:"limit"`
+}
@@ -22,10 +22,43 @@ type User struct {
 	Name      string             `json:"name" bson:"name"`
 	Email     string             `json:"email" bson:"email"`
 	Phone     string             `json:"phone" bson:"phone"`
-	Password  string             `json:"password" bson:"password"`
+	Password  string             `json:"-" bson:"password"` // the hash; never serialized, respond with a user view
 	UserType  string             `json:"user_type" bson:"user_type"`
 	CreatedAt int64              `json:"created_at" bson:"created_at"`
 	UpdatedAt int64              `json:"updated_at" bson:"updated_at"`
+	// PasswordChangeRequired restricts the user to changing their password, as
+	// for an admin created with a one-off password.
+	PasswordChangeRequired bool `json:"password_change_required" bson:"password_change_required"`
+	// PendingEmail is an email change waiting to be confirmed; only
+	// ConfirmEmailChange moves it into Email.
+	PendingEmail *PendingEmail `json:"-" bson:"pending_email,omitempty"`
+}
+
+// UserChanges are the fields of a user UpdateUser sets. Nil fields, and a zero
+// UpdatedAt, are left as they are, so an update can't write back a stale read
+// of the rest of the user.
+type UserChanges struct {
+	Name                   *string `bson:"name,omitempty"`
+	Phone                  *string `bson:"phone,omitempty"`
+	Password               *string `bson:"password,omitempty"`
+	UserType               *string `bson:"user_type,omitempty"`
+	PasswordChangeRequired *bool   `bson:"password_change_required,omitempty"`
+	UpdatedAt              int64   `bson:"updated_at,omitempty"`
+}
+
+// PendingEmail is a new address and the OTP sent to it to prove the user owns it.
+type PendingEmail struct {
+	Email  string `json:"email" bson:"email"`
+	Otp    int64  `json:"-" bson:"otp"`
+	SentAt int64  `json:"sent_at" bson:"sent_at"`
+}
+
+type EmailChangeClient struct {
+	Email string `json:"email"`
+}
+
+type EmailChangeConfirmClient struct {
+	Otp int64 `json:"otp"`
 }
 
 type Address struct {
@@ -0,0 +1,53 @@
+package types
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// User views are what the API returns for a User. Each one copies fields
+// explicitly, so a field added to User, credentials above all, stays private
+// until a view opts in to it.
+
+// PublicUser holds the fields every user view shares. No route serves it on
+// its own, since users may only read their own account.
+type PublicUser struct {
+	Id   primitive.ObjectID `json:"_id"`
+	Name string             `json:"name"`
+}
+
+// UserProfile is a user's view of their own account.
+type UserProfile struct {
+	PublicUser
+	Email string `json:"email"`
+	// PendingEmail is an address the user asked to change to and hasn't confirmed yet.
+	PendingEmail string `json:"pending_email,omitempty"`
+	Phone        string `json:"phone"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// AdminUserView is what administrators see of any account.
+type AdminUserView struct {
+	UserProfile
+	UserType string `json:"user_type"`
+}
+
+func NewPublicUser(u User) PublicUser {
+	return PublicUser{Id: u.Id, Name: u.Name}
+}
+
+func NewUserProfile(u User) UserProfile {
+	p := UserProfile{
+		PublicUser: NewPublicUser(u),
+		Email:      u.Email,
+		Phone:      u.Phone,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+	}
+	if u.PendingEmail != nil {
+		p.PendingEmail = u.PendingEmail.Email
+	}
+	return p
+}
+
+func NewAdminUserView(u User) AdminUserView {
+	return AdminUserView{UserProfile: NewUserProfile(u), UserType: u.UserType}
+}
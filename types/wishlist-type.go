@@ -0,0 +1,43 @@
+package types
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Wishlist is a named list of products a user saved for later.
+type Wishlist struct {
+	Id         primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
+	UserId     primitive.ObjectID   `json:"-" bson:"user_id"`
+	Name       string               `json:"name" bson:"name"`
+	ProductIDs []primitive.ObjectID `json:"product_ids" bson:"product_ids"`
+	// ShareToken, when set, lets anyone read the list through its share link.
+	ShareToken string `json:"share_token,omitempty" bson:"share_token,omitempty"`
+	CreatedAt  int64  `json:"created_at" bson:"created_at"`
+	UpdatedAt  int64  `json:"updated_at" bson:"updated_at"`
+}
+
+type WishlistClient struct {
+	Name string `json:"name"`
+}
+
+type WishlistItemClient struct {
+	ProductID string `json:"product_id"`
+}
+
+// WishlistDetail is a wishlist with its products looked up. Products that
+// have since been deleted are left out.
+type WishlistDetail struct {
+	Wishlist
+	Products []Product `json:"products"`
+}
+
+// SharedWishlist is the read-only view of a wishlist served through its share link.
+type SharedWishlist struct {
+	Name      string    `json:"name"`
+	Products  []Product `json:"products"`
+	UpdatedAt int64     `json:"updated_at"`
+}
+
+// WishlistShare is the link a wishlist can be read at without logging in.
+type WishlistShare struct {
+	ShareToken string `json:"share_token"`
+	Path       string `json:"path"`
+}